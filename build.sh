@@ -11,6 +11,8 @@ go_is_not_installed=`which go`
 go get github.com/cactus/go-statsd-client/statsd
 go get github.com/vharitonsky/iniflags
 go get gopkg.in/mgo.v2
+go get gopkg.in/yaml.v2
 
-# now build it
-go build
+# now build it, stamped with the version from git when there is one
+version=`git describe --tags --always 2>/dev/null || echo dev`
+go build -ldflags "-X main.version=$version"
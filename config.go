@@ -3,72 +3,131 @@ package main
 import (
 	"flag"
 	"fmt"
+	"github.com/linkonic/mgo-statsd/mgostatsd"
 	"github.com/vharitonsky/iniflags"
-	"time"
+	"os"
+	"strings"
 )
 
-type strings []string
+type stringList []string
 
-type Mongo struct {
-	Addresses []string
-	User      string
-	Pass      string
-}
-
-type Statsd struct {
-	Host    string
-	Port    int
-	Env     string
-	Cluster string
-}
-
-type Config struct {
-	Interval time.Duration
-	Mongo    Mongo
-	Statsd   Statsd
-}
-
-func (s *strings) String() string {
+func (s *stringList) String() string {
 	return fmt.Sprintf("%s", *s)
 }
 
-func (s *strings) Set(value string) error {
+func (s *stringList) Set(value string) error {
 	*s = append(*s, value)
 	return nil
 }
 
-var mongo_addresses strings
+var (
+	mongo_addresses stringList
+	metric_paths    stringList
+	rollup_match    stringList
+)
+
+// LoadConfig builds the configuration from, in increasing precedence, the
+// built-in defaults, the -yaml_config file and the command line (or
+// iniflags -config file).
+func LoadConfig() (mgostatsd.Config, error) {
+	cfg := mgostatsd.DefaultConfig()
+	yaml_config := yamlConfigPath(os.Args[1:])
+	if len(yaml_config) > 0 {
+		err := mgostatsd.LoadYAML(yaml_config, &cfg)
+		if err != nil {
+			return cfg, err
+		}
+	}
 
-func LoadConfig() Config {
-	var (
-		mongo_user     = flag.String("mongo_user", "", "MongoDB User")
-		mongo_pass     = flag.String("mongo_pass", "", "MongoDB Password")
-		statsd_host    = flag.String("statsd_host", "localhost", "StatsD Host")
-		statsd_port    = flag.Int("statsd_port", 8125, "StatsD Port")
-		statsd_env     = flag.String("statsd_env", "dev", "StatsD metric environment prefix")
-		statsd_cluster = flag.String("statsd_cluster", "0", "StatsD metric cluster prefix")
-		interval       = flag.Duration("interval", 5*time.Second, "Polling interval")
-	)
+	flag.String("yaml_config", yaml_config, "Path to a YAML config file")
+	flag.StringVar(&cfg.Mongo.User, "mongo_user", cfg.Mongo.User, "MongoDB User")
+	flag.StringVar(&cfg.Mongo.Pass, "mongo_pass", cfg.Mongo.Pass, "MongoDB Password")
+	flag.StringVar(&cfg.Mongo.PassFrom.File, "mongo_pass_file", cfg.Mongo.PassFrom.File, "File to read the MongoDB Password from")
+	flag.StringVar(&cfg.Mongo.PassFrom.Env, "mongo_pass_env", cfg.Mongo.PassFrom.Env, "Environment variable to read the MongoDB Password from")
+	flag.StringVar(&cfg.Mongo.PassFrom.Command, "mongo_pass_command", cfg.Mongo.PassFrom.Command, "Shell command printing the MongoDB Password")
+	flag.StringVar(&cfg.Mongo.AuthMechanism, "mongo_auth_mechanism", cfg.Mongo.AuthMechanism, "MongoDB authentication mechanism, e.g. SCRAM-SHA-1 or MONGODB-X509; empty negotiates")
+	flag.StringVar(&cfg.Mongo.AuthSource, "mongo_auth_source", cfg.Mongo.AuthSource, "MongoDB database to authenticate against, empty for admin")
+	flag.BoolVar(&cfg.Mongo.TLS.Enabled, "mongo_tls", cfg.Mongo.TLS.Enabled, "Connect to MongoDB over TLS")
+	flag.StringVar(&cfg.Mongo.TLS.CAFile, "mongo_tls_ca_file", cfg.Mongo.TLS.CAFile, "PEM file of the CAs to verify MongoDB servers with, empty for the system roots")
+	flag.StringVar(&cfg.Mongo.TLS.CertFile, "mongo_tls_cert_file", cfg.Mongo.TLS.CertFile, "PEM file of the TLS client certificate")
+	flag.StringVar(&cfg.Mongo.TLS.KeyFile, "mongo_tls_key_file", cfg.Mongo.TLS.KeyFile, "PEM file of the TLS client key, empty if it is in the certificate file")
+	flag.BoolVar(&cfg.Mongo.TLS.InsecureSkipVerify, "mongo_tls_insecure", cfg.Mongo.TLS.InsecureSkipVerify, "Skip verifying MongoDB server certificates")
+	flag.StringVar(&cfg.Statsd.Transport, "statsd_transport", cfg.Statsd.Transport, "StatsD transport: udp, tcp, unix or unixgram")
+	flag.StringVar(&cfg.Statsd.Host, "statsd_host", cfg.Statsd.Host, "StatsD Host")
+	flag.IntVar(&cfg.Statsd.Port, "statsd_port", cfg.Statsd.Port, "StatsD Port")
+	flag.StringVar(&cfg.Statsd.Socket, "statsd_socket", cfg.Statsd.Socket, "StatsD Unix socket path, for the unix and unixgram transports")
+	flag.IntVar(&cfg.Statsd.PacketSize, "statsd_packet_size", cfg.Statsd.PacketSize, "Pack metrics into packets of up to this many bytes, e.g. 512, 1432 or 8932; 0 sends one per metric")
+	flag.IntVar(&cfg.Statsd.Spool.Size, "statsd_spool_size", cfg.Statsd.Spool.Size, "Spool up to this many bytes of metrics while statsd is unreachable; 0 drops them")
+	flag.StringVar(&cfg.Statsd.Spool.Path, "statsd_spool_path", cfg.Statsd.Spool.Path, "File to keep the spool in across restarts")
+	flag.StringVar(&cfg.Statsd.TagStyle, "statsd_tag_style", cfg.Statsd.TagStyle, "How tags are sent: path or dogstatsd")
+	flag.IntVar(&cfg.Statsd.Rollup.Samples, "statsd_rollup_samples", cfg.Statsd.Rollup.Samples, "Send the min, max, avg and p95 of this many samples of -statsd_rollup_match gauges instead of each; 0 disables")
+	flag.Var(&rollup_match, "statsd_rollup_match", "Gauge name pattern to roll up, e.g. connections.*")
+	flag.StringVar(&cfg.Statsd.Naming, "statsd_naming", cfg.Statsd.Naming, "Metric naming preset: default, graphite, datadog or telegraf")
+	flag.StringVar(&cfg.Statsd.Env, "statsd_env", cfg.Statsd.Env, "StatsD metric environment prefix")
+	flag.StringVar(&cfg.Statsd.Cluster, "statsd_cluster", cfg.Statsd.Cluster, "StatsD metric cluster prefix")
+	flag.StringVar(&cfg.Discovery.Kubernetes.LabelSelector, "k8s_label_selector", cfg.Discovery.Kubernetes.LabelSelector, "Discover MongoDB pods matching this Kubernetes label selector")
+	flag.StringVar(&cfg.Discovery.Kubernetes.Namespace, "k8s_namespace", cfg.Discovery.Kubernetes.Namespace, "Kubernetes namespace to discover pods in, empty for all")
+	flag.IntVar(&cfg.Discovery.Kubernetes.Port, "k8s_port", cfg.Discovery.Kubernetes.Port, "MongoDB port of discovered pods")
+	flag.DurationVar(&cfg.Discovery.Kubernetes.Refresh, "k8s_refresh", cfg.Discovery.Kubernetes.Refresh, "How often to relist Kubernetes pods")
+	flag.StringVar(&cfg.Discovery.Srv.Name, "srv_name", cfg.Discovery.Srv.Name, "Discover targets from the _mongodb._tcp SRV records of this name")
+	flag.BoolVar(&cfg.Discovery.Srv.Direct, "srv_direct", cfg.Discovery.Srv.Direct, "Poll every SRV record as its own target")
+	flag.DurationVar(&cfg.Discovery.Srv.Refresh, "srv_refresh", cfg.Discovery.Srv.Refresh, "How often to re-resolve the SRV records")
+	flag.StringVar(&cfg.Discovery.Consul.Service, "consul_service", cfg.Discovery.Consul.Service, "Discover healthy instances of this Consul service")
+	flag.StringVar(&cfg.Discovery.Consul.Tag, "consul_tag", cfg.Discovery.Consul.Tag, "Only discover Consul service instances with this tag")
+	flag.StringVar(&cfg.Discovery.Consul.Address, "consul_address", cfg.Discovery.Consul.Address, "Consul agent HTTP address")
+	flag.StringVar(&cfg.Discovery.Consul.Datacenter, "consul_datacenter", cfg.Discovery.Consul.Datacenter, "Consul datacenter, empty for the agent's")
+	flag.StringVar(&cfg.Discovery.Consul.TokenFrom.File, "consul_token_file", cfg.Discovery.Consul.TokenFrom.File, "File to read the Consul ACL token from")
+	flag.DurationVar(&cfg.Discovery.Consul.Refresh, "consul_refresh", cfg.Discovery.Consul.Refresh, "How often to query Consul for healthy instances")
+	flag.StringVar(&cfg.Leader.Lock, "leader_lock", cfg.Leader.Lock, "Elect one publishing agent with a mongo or kubernetes lock, empty to always publish")
+	flag.StringVar(&cfg.Leader.Name, "leader_name", cfg.Leader.Name, "Name of the leader lock")
+	flag.DurationVar(&cfg.Leader.TTL, "leader_ttl", cfg.Leader.TTL, "How long a leader lock is held without renewal")
+	flag.StringVar(&cfg.Leader.Namespace, "leader_namespace", cfg.Leader.Namespace, "Kubernetes namespace of the leader lease, empty for the agent's own")
+	flag.StringVar(&cfg.Admin.Listen, "admin_listen", cfg.Admin.Listen, "Serve the admin API on this host:port")
+	flag.StringVar(&cfg.LogLevel, "log_level", cfg.LogLevel, "Log level: debug, info, warn or error")
+	flag.DurationVar(&cfg.Intervals.ServerStatus, "interval", cfg.Intervals.ServerStatus, "serverStatus polling interval")
+	flag.DurationVar(&cfg.Intervals.DbStats, "db_stats_interval", cfg.Intervals.DbStats, "dbStats polling interval, 0 disables")
+	flag.DurationVar(&cfg.Intervals.ReplSet, "repl_set_interval", cfg.Intervals.ReplSet, "replSetGetStatus polling interval, 0 disables")
+	flag.DurationVar(&cfg.Intervals.Balancer, "balancer_interval", cfg.Intervals.Balancer, "Balancer and chunk migration polling interval on mongos, 0 disables")
+	flag.DurationVar(&cfg.Intervals.ConnPool, "conn_pool_interval", cfg.Intervals.ConnPool, "connPoolStats polling interval, 0 disables")
+	flag.DurationVar(&cfg.Schedule.Jitter, "jitter", cfg.Schedule.Jitter, "Maximum random delay added to each poll")
+	flag.IntVar(&cfg.Schedule.MaxConcurrency, "max_concurrency", cfg.Schedule.MaxConcurrency, "Maximum number of polls running at once")
+	flag.BoolVar(&cfg.Schedule.Align, "align", cfg.Schedule.Align, "Align polls to wall-clock multiples of the interval")
+	flag.StringVar(&cfg.Metrics.Counters, "counters", cfg.Metrics.Counters, "Send operation counters as absolute gauges or delta counters")
+	flag.StringVar(&cfg.Metrics.Units.Memory, "memory_unit", cfg.Metrics.Units.Memory, "Send memory sizes in megabytes or bytes")
+	flag.StringVar(&cfg.Metrics.Units.Time, "time_unit", cfg.Metrics.Units.Time, "Send lock times and uptime in their native unit or ms")
+	flag.BoolVar(&cfg.Metrics.LatencyHistograms, "latency_histograms", cfg.Metrics.LatencyHistograms, "Emit full opLatencies histograms")
+	flag.BoolVar(&cfg.Metrics.AllNumeric, "all_numeric", cfg.Metrics.AllNumeric, "Emit every numeric serverStatus field")
+	flag.BoolVar(&cfg.Metrics.ClusterAggregates, "cluster_aggregates", cfg.Metrics.ClusterAggregates, "Also emit rollups across all targets under cluster.")
+	flag.Var(&metric_paths, "metric_path", "serverStatus field pattern to emit, e.g. wiredTiger.cache.*")
 
-	flag.Var(&mongo_addresses, "mongo_address", "List of mongo addresses in host:port format")
+	flag.Var(&mongo_addresses, "mongo_address", "List of mongo addresses in host:port format, or one mongodb+srv://name")
 	iniflags.Parse()
-	if len(mongo_addresses) == 0 {
-		mongo_addresses = append(mongo_addresses, "localhost:27017")
+	if len(mongo_addresses) > 0 {
+		cfg.Mongo.Addresses = mongo_addresses
 	}
-	cfg := Config{
-		Interval: *interval,
-		Mongo: Mongo{
-			Addresses: mongo_addresses,
-			User:      *mongo_user,
-			Pass:      *mongo_pass,
-		},
-		Statsd: Statsd{
-			Host:    *statsd_host,
-			Port:    *statsd_port,
-			Env:     *statsd_env,
-			Cluster: *statsd_cluster,
-		},
+	if len(metric_paths) > 0 {
+		cfg.Metrics.Paths = metric_paths
 	}
+	if len(rollup_match) > 0 {
+		cfg.Statsd.Rollup.Match = rollup_match
+	}
+	return cfg, cfg.Validate()
+}
 
-	return cfg
+// yamlConfigPath finds -yaml_config before flags are parsed, so the file
+// can supply defaults that flags given on the command line override.
+func yamlConfigPath(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name := strings.TrimLeft(arg, "-")
+		if name == "yaml_config" && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(name, "yaml_config=") {
+			return strings.TrimPrefix(name, "yaml_config=")
+		}
+	}
+	return ""
 }
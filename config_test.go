@@ -0,0 +1,20 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestLoadConfigSrvAddress(t *testing.T) {
+	args := os.Args
+	defer func() { os.Args = args }()
+	os.Args = []string{"mgo-statsd", "-mongo_address", "mongodb+srv://cluster.example.com"}
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %s", err)
+	}
+	if len(config.Mongo.Addresses) != 1 || config.Mongo.Addresses[0] != "mongodb+srv://cluster.example.com" {
+		t.Errorf("mongo.addresses = %q", config.Mongo.Addresses)
+	}
+}
@@ -1,314 +1,142 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
-	"github.com/cactus/go-statsd-client/statsd"
-	"gopkg.in/mgo.v2"
-	"gopkg.in/mgo.v2/bson"
+	"github.com/linkonic/mgo-statsd/mgostatsd"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
-	"time"
 )
 
-type Connections struct {
-	Current      int64 "current"
-	Available    int64 "available"
-	TotalCreated int64 "totalCreated"
-}
-
-type Mem struct {
-	Resident          int64 "resident"
-	Virtual           int64 "virtual"
-	Mapped            int64 "mapped"
-	MappedWithJournal int64 "mappedWithJournal"
-}
-
-type RWT struct {
-	Readers int64 "readers"
-	Writers int64 "writers"
-	Total   int64 "total"
-}
-
-type GlobalLock struct {
-	TotalTime     int64 "totalTime"
-	LockTime      int64 "lockTime"
-	CurrentQueue  RWT   "currentQueue"
-	ActiveClients RWT   "activeClients"
-}
-
-type Opcounters struct {
-	Insert  int64 "insert"
-	Query   int64 "query"
-	Update  int64 "update"
-	Delete  int64 "delete"
-	GetMore int64 "getmore"
-	Command int64 "command"
-}
-
-type ExtraInfo struct {
-	PageFaults       int64 "page_faults"
-	HeapUsageInBytes int64 "heap_usage_bytes"
-}
-
-type ServerStatus struct {
-	Host                 string              "host"
-	Version              string              "version"
-	Process              string              "process"
-	Pid                  int64               "pid"
-	Uptime               int64               "uptime"
-	UptimeInMillis       int64               "uptimeMillis"
-	UptimeEstimate       int64               "uptimeEstimate"
-	LocalTime            bson.MongoTimestamp "localTime"
-	Connections          Connections         "connections"
-	ExtraInfo            ExtraInfo           "extra_info"
-	Mem                  Mem                 "mem"
-	GlobalLocks          GlobalLock          "globalLock"
-	Opcounters           Opcounters          "opcounters"
-	OpcountersReplicaSet Opcounters          "opcountersRepl"
-}
-
-func serverStatus(mongo_config Mongo) ServerStatus {
-	info := mgo.DialInfo{
-		Addrs:   mongo_config.Addresses,
-		Direct:  false,
-		Timeout: time.Second * 30,
-	}
-
-	session, err := mgo.DialWithInfo(&info)
-	if err != nil {
-		panic(err)
-	}
-	defer session.Close()
-
-	if len(mongo_config.User) > 0 {
-		cred := mgo.Credential{Username: mongo_config.User, Password: mongo_config.Pass}
-		err = session.Login(&cred)
-		if err != nil {
-			panic(err)
-		}
-	}
+// Exit codes, so an orchestrator can tell a bad configuration, which
+// restarting won't fix, from a failure at runtime.
+const (
+	exitRuntime = 1
+	exitUsage   = 2
+	exitConfig  = 78 // EX_CONFIG in sysexits.h
+)
 
-	// Optional. Switch the session to a monotonic behavior.
-	session.SetMode(mgo.Monotonic, true)
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "dev"
 
-	var s ServerStatus
-	if err := session.Run("serverStatus", &s); err != nil {
-		panic(err)
-	}
-	return s
+// commands maps each subcommand to what it runs with the loaded
+// configuration.
+var commands = map[string]func(config mgostatsd.Config) error{
+	"run":          run,
+	"check":        check,
+	"print-config": printConfig,
+	"list-metrics": listMetrics,
 }
 
-func pushConnections(client statsd.Statter, connections Connections) error {
-	var err error
-	// Connections
-	err = client.Gauge("connections.current", int64(connections.Current), 1.0)
-	if err != nil {
-		return err
-	}
-
-	err = client.Gauge("connections.available", int64(connections.Available), 1.0)
-	if err != nil {
-		return err
-	}
-
-	err = client.Gauge("connections.created", int64(connections.TotalCreated), 1.0)
-	if err != nil {
-		return err
-	}
-
-	return nil
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [run|check|print-config|list-metrics|version] [flags]\n\n", os.Args[0])
+	fmt.Fprintln(os.Stderr, "  run           poll Mongo and send metrics to statsd (the default)")
+	fmt.Fprintln(os.Stderr, "  check         check that every Mongo target and statsd can be reached")
+	fmt.Fprintln(os.Stderr, "  print-config  print the effective configuration, redacted, and check it")
+	fmt.Fprintln(os.Stderr, "  list-metrics  print the name and type of every metric that would be sent")
+	fmt.Fprintln(os.Stderr, "  version       print the version")
+	fmt.Fprintln(os.Stderr, "\nFlags:")
+	flag.PrintDefaults()
 }
 
-func pushOpcounters(client statsd.Statter, opscounters Opcounters) error {
-	var err error
-
-	// Ops Counters (non-RS)
-	err = client.Gauge("ops.inserts", opscounters.Insert, 1.0)
-	if err != nil {
-		return err
+func main() {
+	// Without a subcommand the agent runs, as it did before there were any.
+	command := "run"
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		command = os.Args[1]
+		os.Args = append(os.Args[:1], os.Args[2:]...)
 	}
 
-	err = client.Gauge("ops.queries", opscounters.Query, 1.0)
-	if err != nil {
-		return err
+	if command == "version" {
+		fmt.Println(version)
+		return
 	}
 
-	err = client.Gauge("ops.updates", opscounters.Update, 1.0)
-	if err != nil {
-		return err
+	fn, ok := commands[command]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", command)
+		usage()
+		os.Exit(exitUsage)
 	}
 
-	err = client.Gauge("ops.deletes", opscounters.Delete, 1.0)
+	flag.Usage = usage
+	config, err := LoadConfig()
 	if err != nil {
-		return err
+		fmt.Println(err)
+		os.Exit(exitConfig)
 	}
-
-	err = client.Gauge("ops.getmores", opscounters.GetMore, 1.0)
+	level, err := mgostatsd.ParseLevel(config.LogLevel)
 	if err != nil {
-		return err
+		fmt.Println(err)
+		os.Exit(exitConfig)
 	}
+	mgostatsd.SetLogLevel(level)
 
-	err = client.Gauge("ops.commands", opscounters.Command, 1.0)
+	err = fn(config)
 	if err != nil {
-		return err
+		fmt.Println(err)
+		if mgostatsd.IsConfigError(err) {
+			os.Exit(exitConfig)
+		}
+		os.Exit(exitRuntime)
 	}
-
-	return nil
 }
 
-func pushMem(client statsd.Statter, mem Mem) error {
-	var err error
-
-	err = client.Gauge("mem.resident", mem.Resident, 1.0)
-	if err != nil {
-		return err
-	}
-
-	err = client.Gauge("mem.virtual", mem.Virtual, 1.0)
+func run(config mgostatsd.Config) error {
+	agent, err := mgostatsd.New(config)
 	if err != nil {
 		return err
 	}
 
-	err = client.Gauge("mem.mapped", mem.Mapped, 1.0)
-	if err != nil {
-		return err
-	}
-
-	err = client.Gauge("mem.mapped_with_journal", mem.MappedWithJournal, 1.0)
-	if err != nil {
-		return err
-	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+		sig := <-ch
+		fmt.Println("Received " + sig.String())
+		cancel()
+	}()
 
+	agent.Run(ctx)
 	return nil
 }
 
-func pushGlobalLocks(client statsd.Statter, glob GlobalLock) error {
-	var err error
-
-	err = client.Gauge("global_lock.total_time", glob.TotalTime, 1.0)
-	if err != nil {
-		return err
-	}
-
-	err = client.Gauge("global_lock.lock_time", glob.LockTime, 1.0)
-	if err != nil {
-		return err
-	}
-
-	err = client.Gauge("global_lock.active_readers", glob.ActiveClients.Readers, 1.0)
-	if err != nil {
-		return err
-	}
-
-	err = client.Gauge("global_lock.active_writers", glob.ActiveClients.Writers, 1.0)
-	if err != nil {
-		return err
-	}
-
-	err = client.Gauge("global_lock.active_total", glob.ActiveClients.Total, 1.0)
-	if err != nil {
-		return err
-	}
-
-	err = client.Gauge("global_lock.queued_readers", glob.CurrentQueue.Readers, 1.0)
-	if err != nil {
-		return err
-	}
-
-	err = client.Gauge("global_lock.queued_writers", glob.CurrentQueue.Writers, 1.0)
-	if err != nil {
-		return err
-	}
-
-	err = client.Gauge("global_lock.queued_total", glob.CurrentQueue.Total, 1.0)
+func check(config mgostatsd.Config) error {
+	agent, err := mgostatsd.New(config)
 	if err != nil {
 		return err
 	}
-
-	return nil
+	return agent.Check()
 }
 
-func pushExtraInfo(client statsd.Statter, info ExtraInfo) error {
-	var err error
-
-	err = client.Gauge("extra.page_faults", info.PageFaults, 1.0)
-	if err != nil {
-		return err
-	}
-
-	err = client.Gauge("extra.heap_usage", info.HeapUsageInBytes, 1.0)
+// printConfig prints the effective configuration with credentials
+// redacted, then checks that Mongo and statsd can be reached with it.
+func printConfig(config mgostatsd.Config) error {
+	dump, err := config.DumpYAML()
 	if err != nil {
 		return err
 	}
-
-	return nil
+	fmt.Print(string(dump))
+	return check(config)
 }
 
-func pushStats(statsd_config Statsd, status ServerStatus) error {
-	prefix := statsd_config.Env
-	if len(statsd_config.Cluster) > 0 {
-		prefix = fmt.Sprintf("%s.%s", prefix, statsd_config.Cluster)
-	}
-	prefix = fmt.Sprintf("%s.%s", prefix, status.Host)
-	host_port := fmt.Sprintf("%s:%d", statsd_config.Host, statsd_config.Port)
-	client, err := statsd.NewClient(host_port, prefix)
-	if err != nil {
-		return err
-	}
-	defer client.Close()
-
-	err = pushConnections(client, status.Connections)
-	if err != nil {
-		return err
-	}
-
-	err = pushOpcounters(client, status.Opcounters)
+func listMetrics(config mgostatsd.Config) error {
+	// Keep target lists and other info logs out of the metric list.
+	mgostatsd.SetLogLevel(mgostatsd.LevelWarn)
+	agent, err := mgostatsd.New(config)
 	if err != nil {
 		return err
 	}
 
-	err = pushMem(client, status.Mem)
+	metrics, err := agent.ListMetrics()
 	if err != nil {
 		return err
 	}
-
-	err = pushGlobalLocks(client, status.GlobalLocks)
-	if err != nil {
-		return err
-	}
-
-	err = pushExtraInfo(client, status.ExtraInfo)
-	if err != nil {
-		return err
+	for _, m := range metrics {
+		fmt.Println(m)
 	}
-
 	return nil
 }
-
-func main() {
-	config := LoadConfig()
-
-	ticker := time.NewTicker(config.Interval)
-	quit := make(chan struct{})
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				err := pushStats(config.Statsd, serverStatus(config.Mongo))
-				if err != nil {
-					fmt.Println(err)
-				}
-			case <-quit:
-				ticker.Stop()
-				return
-			}
-		}
-	}()
-
-	ch := make(chan os.Signal)
-	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
-	sig := <-ch
-	fmt.Println("Received " + sig.String())
-	close(quit)
-}
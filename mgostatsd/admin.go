@@ -0,0 +1,137 @@
+package mgostatsd
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Admin serves the admin API on Listen (host:port) when it is set.
+type Admin struct {
+	Listen string "listen"
+}
+
+// PollStatus is the outcome of one collector's last poll of a target, and
+// how many of its polls in a row have failed.
+type PollStatus struct {
+	Time                time.Time `json:"time"`
+	DurationMs          float64   `json:"duration_ms"`
+	Error               string    `json:"error,omitempty"`
+	ConsecutiveFailures int64     `json:"consecutive_failures"`
+}
+
+// TargetStatus is a target with its last poll by each collector.
+type TargetStatus struct {
+	Target Target                `json:"target"`
+	Polls  map[string]PollStatus `json:"polls"`
+}
+
+type statusStore struct {
+	mu    sync.Mutex
+	polls map[string]map[string]PollStatus
+}
+
+func (s *statusStore) record(target string, collector string, start time.Time, err error) PollStatus {
+	status := PollStatus{Time: start, DurationMs: float64(time.Since(start)) / float64(time.Millisecond)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.polls[target] == nil {
+		s.polls[target] = make(map[string]PollStatus)
+	}
+	if err != nil {
+		status.Error = err.Error()
+		status.ConsecutiveFailures = s.polls[target][collector].ConsecutiveFailures + 1
+	}
+	s.polls[target][collector] = status
+	return status
+}
+
+func (s *statusStore) get(target string) map[string]PollStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	polls := make(map[string]PollStatus, len(s.polls[target]))
+	for name, status := range s.polls[target] {
+		polls[name] = status
+	}
+	return polls
+}
+
+type adminStatus struct {
+	Paused   bool   `json:"paused"`
+	Leader   bool   `json:"leader"`
+	LogLevel string `json:"log_level"`
+	Panics   int64  `json:"panics"`
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+// post wraps handlers that change the agent, which only accept POST.
+func post(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// Handler returns the admin API:
+//
+//	GET  /status              paused state, leadership, log level and panics
+//	POST /pause, /resume      stop and restart scheduled polls
+//	POST /poll                poll every target now and wait for the result
+//	POST /log_level?level=L   change the log level to debug, info, warn or error
+//	GET  /targets             targets and the last poll by each collector
+func (a *Agent) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	status := func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, adminStatus{Paused: a.Paused(), Leader: a.Leader(), LogLevel: LogLevel().String(), Panics: a.Panics()})
+	}
+	mux.HandleFunc("/status", status)
+	mux.HandleFunc("/pause", post(func(w http.ResponseWriter, r *http.Request) {
+		a.Pause()
+		logf(LevelInfo, "admin: collection paused")
+		status(w, r)
+	}))
+	mux.HandleFunc("/resume", post(func(w http.ResponseWriter, r *http.Request) {
+		a.Resume()
+		logf(LevelInfo, "admin: collection resumed")
+		status(w, r)
+	}))
+	mux.HandleFunc("/poll", post(func(w http.ResponseWriter, r *http.Request) {
+		err := a.CollectOnce()
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, a.Targets())
+	}))
+	mux.HandleFunc("/log_level", post(func(w http.ResponseWriter, r *http.Request) {
+		level, err := ParseLevel(r.FormValue("level"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		SetLogLevel(level)
+		status(w, r)
+	}))
+	mux.HandleFunc("/targets", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, a.Targets())
+	})
+
+	return mux
+}
@@ -0,0 +1,306 @@
+// Package mgostatsd polls MongoDB servers for their status and ships it
+// as metrics to statsd. It is what the mgo-statsd command runs, and can be
+// embedded by other Go programs through Agent.
+package mgostatsd
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// An Agent polls its targets with every enabled collector and pushes the
+// results to statsd.
+type Agent struct {
+	// panics is first so it is 64-bit aligned for atomic access.
+	panics int64
+
+	config     Config
+	targets    *targetSet
+	discoverer discoverer
+	elector    elector
+	// heartbeat is the collector whose polls report whether each
+	// target is up.
+	heartbeat string
+	// workers holds a token for every poll in progress, bounding them to
+	// Schedule.MaxConcurrency across all collectors.
+	workers chan struct{}
+
+	paused  int32
+	leader  int32
+	status  statusStore
+	skipped skipStore
+}
+
+// New validates config, resolves its secrets and finds the initial
+// targets.
+func New(config Config) (*Agent, error) {
+	config.normalize()
+	err := config.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	err = resolveSecrets(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	config.Statsd.relabel, err = compileRelabel(config.Statsd.Relabel)
+	if err != nil {
+		return nil, err
+	}
+
+	targets, d, err := newTargets(config)
+	if err != nil {
+		return nil, err
+	}
+	config = config.withState(newState())
+
+	a := &Agent{
+		config:     config,
+		targets:    targets,
+		discoverer: d,
+		status:     statusStore{polls: make(map[string]map[string]PollStatus)},
+		skipped:    skipStore{skipped: make(map[string]bool)},
+		workers:    make(chan struct{}, config.Schedule.MaxConcurrency),
+	}
+	for _, c := range collectors(config) {
+		if c.interval > 0 {
+			a.heartbeat = c.name
+			break
+		}
+	}
+
+	if config.Leader.enabled() {
+		a.elector, err = newElector(config, targets)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		a.leader = 1
+	}
+	return a, nil
+}
+
+// Run polls every collector on its own schedule, and keeps discovered
+// targets up to date, until ctx is done. If an admin address is
+// configured the admin API is served on it meanwhile. The connections to
+// statsd are closed when Run returns.
+func (a *Agent) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+
+	if len(a.config.Admin.Listen) > 0 {
+		server := &http.Server{Addr: a.config.Admin.Listen, Handler: a.Handler()}
+		go func() {
+			<-ctx.Done()
+			server.Close()
+		}()
+		go func() {
+			err := server.ListenAndServe()
+			if err != nil && err != http.ErrServerClosed {
+				logf(LevelError, "admin: %s", err)
+			}
+		}()
+	}
+
+	if a.discoverer != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			watch(a.discoverer, a.config.Discovery.refresh(), a.targets, ctx.Done())
+		}()
+	}
+	if a.elector != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.elect(ctx.Done())
+		}()
+	}
+
+	for _, c := range collectors(a.config) {
+		if c.interval > 0 {
+			wg.Add(1)
+			go func(c collector) {
+				defer wg.Done()
+				a.run(c, ctx.Done())
+			}(c)
+		}
+	}
+
+	wg.Wait()
+	a.config.state.streams.close()
+	return ctx.Err()
+}
+
+func (a *Agent) run(c collector, quit <-chan struct{}) {
+	next := time.Now()
+	if a.config.Schedule.Align {
+		next = next.Truncate(c.interval)
+	}
+	for {
+		next = next.Add(c.interval)
+		timer := time.NewTimer(time.Until(next) + a.config.Schedule.jitter())
+		select {
+		case <-timer.C:
+			if !a.Paused() && a.Leader() {
+				a.pollAll(c, quit)
+			}
+		case <-quit:
+			timer.Stop()
+			return
+		}
+
+		// Like time.Ticker, drop the slots a slow poll overran instead of
+		// firing them back to back.
+		for next.Add(c.interval).Before(time.Now()) {
+			next = next.Add(c.interval)
+		}
+	}
+}
+
+// pollAll runs c against every target, as many at a time as the worker
+// pool allows, and then pushes the cluster aggregates of the round if
+// enabled. It returns the first error. Once quit is closed no more polls
+// are started, and pollAll returns when those in progress are done,
+// without the aggregates of the unfinished round.
+func (a *Agent) pollAll(c collector, quit <-chan struct{}) error {
+	config := a.config
+	if config.Metrics.ClusterAggregates {
+		config.aggregate = &clusterAggregate{}
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var first error
+	for _, t := range a.targets.list() {
+		select {
+		case a.workers <- struct{}{}:
+		case <-quit:
+			wg.Wait()
+			return first
+		}
+		wg.Add(1)
+		go func(t Target) {
+			defer wg.Done()
+			defer func() { <-a.workers }()
+
+			err := a.poll(c, config, t)
+			mu.Lock()
+			if err != nil && first == nil {
+				first = err
+			}
+			mu.Unlock()
+		}(t)
+	}
+	wg.Wait()
+
+	if config.aggregate != nil {
+		err := config.aggregate.push(config)
+		if err != nil {
+			logf(LevelError, "%s cluster aggregates: %s", c.name, err)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// poll runs c against t, logging and recording the outcome. A collector
+// the target's user isn't authorized to run is disabled for that target
+// after its first failure.
+func (a *Agent) poll(c collector, config Config, t Target) error {
+	if a.skipped.has(t.String(), c.name) {
+		err := pushSkipped(config, t, c.name)
+		if err != nil {
+			logf(LevelError, "%s skipped: %s", t, err)
+		}
+		if c.name == a.heartbeat {
+			// up would stop with the heartbeat; ping needs no
+			// privileges, so it stands in.
+			a.pushUp(config, t, a.ping(config, t))
+		}
+		return nil
+	}
+
+	start := time.Now()
+	err := a.recoverPoll(c, config, t)
+	status := a.status.record(t.String(), c.name, start, err)
+	if isUnauthorized(err) && a.skipped.add(t.String(), c.name) {
+		logf(LevelWarn, "%s %s: %s; the user lacks the privileges, so it is skipped for this target until the agent restarts", c.name, t, err)
+	} else if err != nil {
+		logf(LevelError, "%s %s: %s", c.name, t, err)
+	}
+
+	if c.name == a.heartbeat {
+		a.pushUp(config, t, status)
+	}
+	return err
+}
+
+// ping pings t, recording the outcome as its poll by "ping".
+func (a *Agent) ping(config Config, t Target) PollStatus {
+	start := time.Now()
+	session, err := dial(config.Mongo, t)
+	if err == nil {
+		err = session.Ping()
+		session.Close()
+	}
+	if err != nil {
+		logf(LevelError, "ping %s: %s", t, err)
+	}
+	return a.status.record(t.String(), "ping", start, err)
+}
+
+func (a *Agent) pushUp(config Config, t Target, status PollStatus) {
+	err := pushUp(config, t, status)
+	if err != nil {
+		logf(LevelError, "%s up: %s", t, err)
+	}
+}
+
+// CollectOnce immediately runs every enabled collector against every
+// target, even while paused, and returns the first error.
+func (a *Agent) CollectOnce() error {
+	var first error
+	for _, c := range collectors(a.config) {
+		if c.interval <= 0 {
+			continue
+		}
+		err := a.pollAll(c, nil)
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Pause stops scheduled polls until Resume is called.
+func (a *Agent) Pause() {
+	atomic.StoreInt32(&a.paused, 1)
+}
+
+// Resume restarts scheduled polls after Pause.
+func (a *Agent) Resume() {
+	atomic.StoreInt32(&a.paused, 0)
+}
+
+// Paused reports whether scheduled polls are paused.
+func (a *Agent) Paused() bool {
+	return atomic.LoadInt32(&a.paused) == 1
+}
+
+// Targets returns the targets currently polled, each with the outcome of
+// the last poll by every collector that has run against it.
+func (a *Agent) Targets() []TargetStatus {
+	targets := a.targets.list()
+	statuses := make([]TargetStatus, len(targets))
+	for i, t := range targets {
+		statuses[i] = TargetStatus{Target: t, Polls: a.status.get(t.String())}
+	}
+	return statuses
+}
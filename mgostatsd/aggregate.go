@@ -0,0 +1,183 @@
+package mgostatsd
+
+import (
+	"github.com/cactus/go-statsd-client/statsd"
+	"sync"
+	"time"
+)
+
+// clusterAggregate sums what one round of polls saw across every target,
+// so dashboards get cluster-wide rollups without summing per-host series.
+type clusterAggregate struct {
+	mu sync.Mutex
+
+	members     int64
+	connections Connections
+	// ops and opsRepl sum the members' counters, or in delta mode their
+	// change since the member's previous poll, in which case counted is
+	// set once a member has one.
+	ops     Opcounters
+	opsRepl Opcounters
+	counted bool
+
+	lagged bool
+	maxLag time.Duration
+}
+
+func addOpcounters(sum *Opcounters, ops Opcounters) {
+	sum.Insert += ops.Insert
+	sum.Query += ops.Query
+	sum.Update += ops.Update
+	sum.Delete += ops.Delete
+	sum.GetMore += ops.GetMore
+	sum.Command += ops.Command
+}
+
+// opcounterDeltas returns how much ops moved since the last call with key,
+// or false when any counter has no previous sample or went backwards.
+func opcounterDeltas(counters *counterStore, key string, ops Opcounters) (Opcounters, bool) {
+	var d Opcounters
+	ok := true
+	for _, f := range []struct {
+		name  string
+		value int64
+		delta *int64
+	}{
+		{"inserts", ops.Insert, &d.Insert},
+		{"queries", ops.Query, &d.Query},
+		{"updates", ops.Update, &d.Update},
+		{"deletes", ops.Delete, &d.Delete},
+		{"getmores", ops.GetMore, &d.GetMore},
+		{"commands", ops.Command, &d.Command},
+	} {
+		var counted bool
+		*f.delta, counted = counters.delta(key+"."+f.name, f.value)
+		ok = ok && counted
+	}
+	return d, ok
+}
+
+// addStatus adds one member's serverStatus to the round. In delta mode
+// each member's operation counters are turned into deltas before they are
+// summed: deltas of the summed counters would drop when a member misses a
+// round and spike when it is back. A member polled for the first time, or
+// just restarted, adds no operations to the round.
+func (c *clusterAggregate) addStatus(config Config, status ServerStatus) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.members++
+	c.connections.Current += status.Connections.Current
+	c.connections.Available += status.Connections.Available
+	c.connections.TotalCreated += status.Connections.TotalCreated
+	if config.Metrics.Counters != counterModeDelta {
+		addOpcounters(&c.ops, status.Opcounters)
+		addOpcounters(&c.opsRepl, status.OpcountersReplicaSet)
+		return
+	}
+
+	// Keys apart from the member's own counters, which its own push
+	// takes the deltas of.
+	key := "cluster/" + status.Host
+	ops, ok := opcounterDeltas(config.state.counters, key+".ops", status.Opcounters)
+	opsRepl, replOk := opcounterDeltas(config.state.counters, key+".ops_repl", status.OpcountersReplicaSet)
+	if ok && replOk {
+		addOpcounters(&c.ops, ops)
+		addOpcounters(&c.opsRepl, opsRepl)
+		c.counted = true
+	}
+}
+
+// incOpcounters sends every counter of ops as a statsd counter.
+func incOpcounters(client statsd.Statter, prefix string, ops Opcounters) error {
+	var err error
+	for _, f := range []struct {
+		name  string
+		value int64
+	}{
+		{"inserts", ops.Insert},
+		{"queries", ops.Query},
+		{"updates", ops.Update},
+		{"deletes", ops.Delete},
+		{"getmores", ops.GetMore},
+		{"commands", ops.Command},
+	} {
+		err = client.Inc(prefix+"."+f.name, f.value, 1.0)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *clusterAggregate) addReplSet(status ReplSetStatus) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, member := range status.lags() {
+		c.lagged = true
+		if member.lag > c.maxLag {
+			c.maxLag = member.lag
+		}
+	}
+}
+
+// push sends the aggregates as <env>.<cluster>.cluster.*, without a host
+// or the tags of any one target.
+func (c *clusterAggregate) push(config Config) (err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.members == 0 && !c.lagged {
+		return nil
+	}
+
+	client, err := newStatter(config.Statsd, "")
+	if err != nil {
+		return err
+	}
+	defer closeStatter(client, &err)
+
+	if c.members > 0 {
+		err = client.Gauge("cluster.members", c.members, 1.0)
+		if err != nil {
+			return err
+		}
+
+		err = pushConnections(client, "cluster.connections", c.connections)
+		if err != nil {
+			return err
+		}
+
+		if config.Metrics.Counters != counterModeDelta {
+			err = pushOpcounters(client, config.state.counters, config.Metrics.Counters, "", "cluster.ops", c.ops)
+			if err != nil {
+				return err
+			}
+
+			err = pushOpcounters(client, config.state.counters, config.Metrics.Counters, "", "cluster.ops_repl", c.opsRepl)
+			if err != nil {
+				return err
+			}
+		} else if c.counted {
+			err = incOpcounters(client, "cluster.ops", c.ops)
+			if err != nil {
+				return err
+			}
+
+			err = incOpcounters(client, "cluster.ops_repl", c.opsRepl)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if c.lagged {
+		err = client.Gauge("cluster.repl.max_lag", int64(c.maxLag/time.Millisecond), 1.0)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package mgostatsd
+
+import (
+	"fmt"
+	"github.com/cactus/go-statsd-client/statsd"
+	"gopkg.in/mgo.v2/bson"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Alert is a threshold rule on a serverStatus field, written as
+// "<path> <op> <value>" with op one of <, <=, >, >=, == and !=, for example
+// "connections.available < 500". Name defaults to the path.
+type Alert struct {
+	Name string "name"
+	Rule string "rule"
+}
+
+func (a Alert) name() string {
+	if len(a.Name) > 0 {
+		return metricName(a.Name)
+	}
+	r, _ := parseRule(a.Rule)
+	return metricName(r.path)
+}
+
+type rule struct {
+	path  string
+	op    string
+	value float64
+}
+
+func parseRule(s string) (rule, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 3 {
+		return rule{}, fmt.Errorf("rule %q is not of the form <path> <op> <value>", s)
+	}
+	switch fields[1] {
+	case "<", "<=", ">", ">=", "==", "!=":
+	default:
+		return rule{}, fmt.Errorf("rule %q has unknown operator %s", s, fields[1])
+	}
+	value, err := strconv.ParseFloat(fields[2], 64)
+	if err != nil {
+		return rule{}, fmt.Errorf("rule %q has non-numeric threshold %s", s, fields[2])
+	}
+	return rule{path: fields[0], op: fields[1], value: value}, nil
+}
+
+func (r rule) breached(v float64) bool {
+	switch r.op {
+	case "<":
+		return v < r.value
+	case "<=":
+		return v <= r.value
+	case ">":
+		return v > r.value
+	case ">=":
+		return v >= r.value
+	case "==":
+		return v == r.value
+	case "!=":
+		return v != r.value
+	}
+	return false
+}
+
+// alertStore remembers which alerts are breached on which host, so only
+// transitions are logged.
+type alertStore struct {
+	mu       sync.Mutex
+	breached map[string]bool
+}
+
+func (s *alertStore) update(key string, breached bool) (changed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed = s.breached[key] != breached
+	s.breached[key] = breached
+	return changed
+}
+
+// pushAlerts checks each rule against the serverStatus document. While a
+// rule is breached its alerts.<name>.breaches counter is incremented every
+// poll; alerts.<name>.active is 1 while breached and 0 otherwise. Entering
+// and leaving the breached state is logged.
+func pushAlerts(client statsd.Statter, alerts *alertStore, host string, rules []Alert, doc bson.M) error {
+	for _, a := range rules {
+		r, err := parseRule(a.Rule)
+		if err != nil {
+			return err
+		}
+		value, ok := lookup(doc, r.path)
+		if !ok {
+			continue
+		}
+		v, ok := float(value)
+		if !ok {
+			continue
+		}
+
+		name := a.name()
+		breached := r.breached(v)
+		if alerts.update(host+"."+name, breached) {
+			if breached {
+				logf(LevelWarn, "alert %s breached on %s: %s is %v", name, host, a.Rule, v)
+			} else {
+				logf(LevelInfo, "alert %s cleared on %s: %s is %v", name, host, a.Rule, v)
+			}
+		}
+
+		var active int64
+		if breached {
+			active = 1
+			err = client.Inc("alerts."+name+".breaches", 1, 1.0)
+			if err != nil {
+				return err
+			}
+		}
+		err = client.Gauge("alerts."+name+".active", active, 1.0)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
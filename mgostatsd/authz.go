@@ -0,0 +1,59 @@
+package mgostatsd
+
+import (
+	"gopkg.in/mgo.v2"
+	"strings"
+	"sync"
+)
+
+// codeUnauthorized is the error code of a command the user lacks the
+// privileges to run.
+const codeUnauthorized = 13
+
+func isUnauthorized(err error) bool {
+	if qerr, ok := err.(*mgo.QueryError); ok {
+		return qerr.Code == codeUnauthorized || strings.HasPrefix(qerr.Message, "not authorized")
+	}
+	return false
+}
+
+// skipStore remembers the collectors each target's user isn't authorized
+// to run, so they are skipped rather than failing every interval.
+type skipStore struct {
+	mu      sync.Mutex
+	skipped map[string]bool
+}
+
+// add marks collector as skipped for target, and reports whether it
+// wasn't already.
+func (s *skipStore) add(target string, collector string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := target + "/" + collector
+	if s.skipped[key] {
+		return false
+	}
+	s.skipped[key] = true
+	return true
+}
+
+func (s *skipStore) has(target string, collector string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.skipped[target+"/"+collector]
+}
+
+// pushSkipped sends collector.skipped.<collector> as 1, under the target's
+// label, for every poll of a collector skipped for lack of privileges.
+func pushSkipped(config Config, t Target, collector string) (err error) {
+	config = config.forTarget(t)
+	client, err := newStatter(config.Statsd, t.label())
+	if err != nil {
+		return err
+	}
+	defer closeStatter(client, &err)
+
+	return client.Gauge("collector.skipped."+collector, 1, 1.0)
+}
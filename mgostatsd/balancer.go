@@ -0,0 +1,158 @@
+package mgostatsd
+
+import (
+	"github.com/cactus/go-statsd-client/statsd"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"time"
+)
+
+type IsMaster struct {
+	Msg string "msg"
+}
+
+type BalancerStatus struct {
+	Mode              string "mode"
+	InBalancerRound   bool   "inBalancerRound"
+	NumBalancerRounds int64  "numBalancerRounds"
+}
+
+// Chunks counts chunk migrations from the config database. Failed and
+// Succeeded are the migrations that ended during the last interval.
+type Chunks struct {
+	Migrating int
+	Jumbo     int
+	Failed    int
+	Succeeded int
+}
+
+// isMongos reports whether session is connected to a mongos, the only
+// place balancerStatus can be run.
+func isMongos(session *mgo.Session) (bool, error) {
+	var m IsMaster
+	err := session.Run("isMaster", &m)
+	return m.Msg == "isdbgrid", err
+}
+
+func balancerStatus(session *mgo.Session) (BalancerStatus, error) {
+	var s BalancerStatus
+	err := session.Run("balancerStatus", &s)
+	return s, err
+}
+
+func chunks(session *mgo.Session, interval time.Duration) (Chunks, error) {
+	var c Chunks
+	var err error
+	config := session.DB("config")
+
+	c.Migrating, err = config.C("migrations").Count()
+	if err != nil {
+		return c, err
+	}
+
+	c.Jumbo, err = config.C("chunks").Find(bson.M{"jumbo": true}).Count()
+	if err != nil {
+		return c, err
+	}
+
+	since := time.Now().Add(-interval)
+	c.Failed, err = config.C("changelog").Find(bson.M{"what": "moveChunk.error", "time": bson.M{"$gte": since}}).Count()
+	if err != nil {
+		return c, err
+	}
+
+	c.Succeeded, err = config.C("changelog").Find(bson.M{"what": "moveChunk.commit", "time": bson.M{"$gte": since}}).Count()
+	return c, err
+}
+
+func pushBalancer(client statsd.Statter, counters *counterStore, mode string, host string, status BalancerStatus, c Chunks) error {
+	var err error
+
+	var enabled, inRound int64
+	if status.Mode != "off" {
+		enabled = 1
+	}
+	if status.InBalancerRound {
+		inRound = 1
+	}
+
+	err = client.Gauge("balancer.enabled", enabled, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("balancer.in_round", inRound, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = pushCounter(client, counters, mode, host, "balancer.rounds", status.NumBalancerRounds)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("chunks.migrating", int64(c.Migrating), 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("chunks.jumbo", int64(c.Jumbo), 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("chunks.migrations_failed", int64(c.Failed), 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("chunks.migrations_succeeded", int64(c.Succeeded), 1.0)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// collectBalancer reports the balancer and chunk migrations of a sharded
+// cluster. Targets that are not a mongos are skipped.
+func collectBalancer(session *mgo.Session, config Config) (err error) {
+	mongos, err := isMongos(session)
+	if err != nil {
+		return err
+	}
+	if !mongos {
+		logf(LevelDebug, "balancer: skipping %v, not a mongos", session.LiveServers())
+		return nil
+	}
+
+	host, err := hostName(session)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	status, err := balancerStatus(session)
+	if err != nil {
+		return err
+	}
+
+	c, err := chunks(session, config.Intervals.Balancer)
+	if err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+
+	client, err := newStatter(config.Statsd, host)
+	if err != nil {
+		return err
+	}
+	defer closeStatter(client, &err)
+
+	err = pushCollectTime(client, "balancer", elapsed)
+	if err != nil {
+		return err
+	}
+
+	return pushBalancer(client, config.state.counters, config.Metrics.Counters, host, status, c)
+}
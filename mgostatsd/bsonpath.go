@@ -0,0 +1,140 @@
+package mgostatsd
+
+import (
+	"github.com/cactus/go-statsd-client/statsd"
+	"gopkg.in/mgo.v2/bson"
+	pathpkg "path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// lookup follows a dot-separated path through a decoded document.
+// Numeric path components index into arrays.
+func lookup(doc interface{}, path string) (interface{}, bool) {
+	for _, key := range strings.Split(path, ".") {
+		switch v := doc.(type) {
+		case bson.M:
+			next, ok := v[key]
+			if !ok {
+				return nil, false
+			}
+			doc = next
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			doc = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// numeric converts the number-like BSON values to the int64 statsd takes.
+// Doubles are truncated and booleans become 0 or 1.
+func numeric(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case float64:
+		return int64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// float converts the number-like BSON values to float64, keeping the
+// fraction of doubles that numeric truncates. Booleans become 0 or 1.
+func float(value interface{}) (float64, bool) {
+	if v, ok := value.(float64); ok {
+		return v, true
+	}
+	n, ok := numeric(value)
+	return float64(n), ok
+}
+
+// walk calls fn with the path of every numeric leaf below doc, visiting
+// document keys in sorted order so emission order is stable.
+func walk(doc interface{}, path []string, fn func(path []string, value int64)) {
+	switch v := doc.(type) {
+	case bson.M:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			walk(v[key], append(path, key), fn)
+		}
+	case []interface{}:
+		for i, item := range v {
+			walk(item, append(path, strconv.Itoa(i)), fn)
+		}
+	default:
+		if n, ok := numeric(v); ok {
+			fn(append([]string(nil), path...), n)
+		}
+	}
+}
+
+// matchPath reports whether a path matches a dot-separated pattern. A
+// component of "**" matches any number of path components, including
+// none, and other components are matched with path.Match, so "*" matches
+// exactly one.
+func matchPath(pattern []string, path []string) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(path); i++ {
+			if matchPath(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(path) == 0 {
+		return false
+	}
+	ok, err := pathpkg.Match(pattern[0], path[0])
+	return err == nil && ok && matchPath(pattern[1:], path[1:])
+}
+
+// pushPaths emits, as gauges under prefix, every numeric leaf of doc that
+// matches one of patterns.
+func pushPaths(client statsd.Statter, prefix string, doc interface{}, patterns []string) error {
+	split := make([][]string, len(patterns))
+	for i, pattern := range patterns {
+		split[i] = strings.Split(pattern, ".")
+	}
+
+	var err error
+	walk(doc, nil, func(path []string, value int64) {
+		if err != nil {
+			return
+		}
+		for _, pattern := range split {
+			if !matchPath(pattern, path) {
+				continue
+			}
+			name := make([]string, len(path))
+			for i, key := range path {
+				name[i] = metricName(key)
+			}
+			err = client.Gauge(prefix+strings.Join(name, "."), value, 1.0)
+			return
+		}
+	})
+	return err
+}
@@ -0,0 +1,43 @@
+package mgostatsd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"opcounters.insert", "opcounters.insert", true},
+		{"opcounters.insert", "opcounters.query", false},
+		{"opcounters.insert", "opcounters.insert.extra", false},
+		{"opcounters.*", "opcounters.insert", true},
+		{"opcounters.*", "opcounters", false},
+		{"opcounters.*", "opcounters.insert.extra", false},
+		{"*.insert", "opcounters.insert", true},
+		{"wired_tiger.cache.bytes_*", "wired_tiger.cache.bytes_read", true},
+		{"wired_tiger.cache.bytes_*", "wired_tiger.cache.pages_read", false},
+		{"**", "opcounters.insert", true},
+		{"**", "opcounters", true},
+		{"metrics.**", "metrics", true},
+		{"metrics.**", "metrics.document.inserted", true},
+		{"metrics.**", "opcounters.insert", false},
+		{"metrics.**.total", "metrics.cursor.open.total", true},
+		{"metrics.**.total", "metrics.total", true},
+		{"metrics.**.total", "metrics.cursor.open.pinned", false},
+		{"**.timeouts", "metrics.cursor.timedOut", false},
+		{"**.*Out", "metrics.cursor.timedOut", true},
+		{"metrics.*.**.total", "metrics.total", false},
+		{"metrics.*.**.total", "metrics.cursor.total", true},
+		{"metrics.[", "metrics.a", false},
+	}
+	for _, tt := range tests {
+		got := matchPath(strings.Split(tt.pattern, "."), strings.Split(tt.path, "."))
+		if got != tt.want {
+			t.Errorf("matchPath(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package mgostatsd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Check connects to every target and pings it, and sends a single
+// agent.check counter to each statsd destination. It returns an error
+// listing every destination that could not be reached. Over udp and
+// unixgram a successful send doesn't mean statsd got the counter, so
+// those destinations are reported as not verifiable rather than ok.
+func (a *Agent) Check() error {
+	var errs []string
+
+	for _, t := range a.targets.list() {
+		session, err := dial(a.config.Mongo, t)
+		if err == nil {
+			err = session.Ping()
+			session.Close()
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("mongo %s: %s", t, err))
+			continue
+		}
+		logf(LevelInfo, "mongo %s: ok", t)
+	}
+
+	// Targets with a destination of their own send to it as well.
+	configs := []Statsd{a.config.Statsd}
+	for _, t := range a.targets.list() {
+		configs = append(configs, a.config.forTarget(t).Statsd)
+	}
+	checked := make(map[string]bool)
+	for _, statsd_config := range configs {
+		dest := destination(statsd_config)
+		if checked[dest] {
+			continue
+		}
+		checked[dest] = true
+
+		client, err := newStatter(statsd_config, "agent")
+		if err == nil {
+			err = client.Inc("check", 1, 1.0)
+			closeStatter(client, &err)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("statsd %s: %s", dest, err))
+		} else if connectionless(statsd_config.Transport) {
+			logf(LevelInfo, "statsd %s: sent, not verifiable (connectionless)", dest)
+		} else {
+			logf(LevelInfo, "statsd %s: ok", dest)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("check failed:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+// connectionless reports whether transport sends datagrams, which can
+// be lost without the sender noticing.
+func connectionless(transport string) bool {
+	return transport == "" || transport == transportUDP || transport == transportUnixgram
+}
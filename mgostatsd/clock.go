@@ -0,0 +1,41 @@
+package mgostatsd
+
+import (
+	"github.com/cactus/go-statsd-client/statsd"
+	"time"
+)
+
+// pushClock emits how far the server's clock is off from the agent's, in
+// milliseconds, as clock.drift_ms, and clock.behind as 1 when the server's
+// clock is behind and 0 otherwise. The drift is sent as an absolute value
+// because statsd reads a gauge with a leading - as a decrement. The
+// server's localTime is compared with the midpoint of the serverStatus
+// round-trip, so the figure is accurate to about half of
+// agent.collect.server_status.ms. Every member is measured against the
+// same agent clock, so the members of a replica set can be compared with
+// each other.
+func pushClock(client statsd.Statter, status ServerStatus) error {
+	if status.LocalTime.IsZero() || status.sampled.IsZero() {
+		return nil
+	}
+	var err error
+	drift := status.LocalTime.Sub(status.sampled)
+
+	var behind int64
+	if drift < 0 {
+		drift = -drift
+		behind = 1
+	}
+
+	err = client.Gauge("clock.drift_ms", int64(drift/time.Millisecond), 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("clock.behind", behind, 1.0)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
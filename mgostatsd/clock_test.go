@@ -0,0 +1,30 @@
+package mgostatsd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPushClock(t *testing.T) {
+	sampled := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		localTime time.Time
+		want      []string
+	}{
+		{sampled, []string{"clock.drift_ms:0|g", "clock.behind:0|g"}},
+		{sampled.Add(250 * time.Millisecond), []string{"clock.drift_ms:250|g", "clock.behind:0|g"}},
+		{sampled.Add(-1500 * time.Millisecond), []string{"clock.drift_ms:1500|g", "clock.behind:1|g"}},
+		{time.Time{}, nil},
+	}
+	for _, tt := range tests {
+		fake := &fakeStatter{}
+		err := pushClock(fake, ServerStatus{LocalTime: tt.localTime, sampled: sampled})
+		if err != nil {
+			t.Fatalf("pushClock: %s", err)
+		}
+		if !reflect.DeepEqual(fake.lines, tt.want) {
+			t.Errorf("localTime %s: sent %q, want %q", tt.localTime.Sub(sampled), fake.lines, tt.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package mgostatsd
+
+import (
+	"github.com/cactus/go-statsd-client/statsd"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"time"
+)
+
+// A collector runs one Mongo command on its own interval and pushes the
+// result to statsd. Each collector gets an independent schedule so cheap
+// commands can be polled often and expensive ones rarely.
+type collector struct {
+	name     string
+	interval time.Duration
+	collect  func(session *mgo.Session, config Config) error
+}
+
+func collectors(config Config) []collector {
+	c := []collector{
+		{"serverStatus", config.Intervals.ServerStatus, collectServerStatus},
+		{"dbStats", config.Intervals.DbStats, collectDbStats},
+		{"replSetGetStatus", config.Intervals.ReplSet, collectReplSet},
+		{"connPoolStats", config.Intervals.ConnPool, collectConnPool},
+		{"balancer", config.Intervals.Balancer, collectBalancer},
+	}
+	for _, custom := range config.CustomCommands {
+		c = append(c, custom.collector(config.Intervals.ServerStatus))
+	}
+	return c
+}
+
+func (c collector) poll(config Config, t Target) error {
+	session, err := dial(config.Mongo, t)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	// Metrics from this target carry its tags as well as the configured
+	// ones, and go to its own destination if it has one.
+	return c.collect(session, config.forTarget(t))
+}
+
+// pushCollectTime emits how long the Mongo command behind a collector took
+// as agent.collect.<name>.ms. The round-trip grows as mongod gets busy,
+// often before any of the metrics it returns show it.
+func pushCollectTime(client statsd.Statter, name string, d time.Duration) error {
+	return client.TimingDuration("agent.collect."+name+".ms", d, 1.0)
+}
+
+// hostName returns the host serverStatus reports, with the port when it
+// isn't the default, so metrics from every collector share one prefix per
+// server. Every section serverStatus can leave out is turned off, leaving
+// little more than the host.
+func hostName(session *mgo.Session) (string, error) {
+	cmd := bson.D{{Name: "serverStatus", Value: 1}}
+	for _, section := range append(defaultSections, optionalSections...) {
+		cmd = append(cmd, bson.DocElem{Name: section, Value: 0})
+	}
+
+	var status struct {
+		Host string "host"
+	}
+	err := session.Run(cmd, &status)
+	return status.Host, err
+}
+
+// metricName makes a database, member or document key name safe to use
+// as a single statsd path component.
+func metricName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,460 @@
+package mgostatsd
+
+import (
+	"fmt"
+	"github.com/cactus/go-statsd-client/statsd"
+	"math/rand"
+	"path"
+	"strings"
+	"time"
+)
+
+// Mongo is how the agent connects to the servers. AuthMechanism
+// defaults to what the server negotiates; MONGODB-X509 authenticates with
+// the TLS client certificate, as User or, when User is empty, as the
+// certificate subject.
+type Mongo struct {
+	Addresses     []string "addresses"
+	User          string   "user"
+	Pass          string   "pass"
+	PassFrom      Secret   "pass_from"
+	AuthMechanism string   "auth_mechanism"
+	AuthSource    string   "auth_source"
+	TLS           TLS      "tls"
+}
+
+// Statsd is where metrics are sent. Transport is one of udp (the
+// default), tcp, unix or unixgram; the last two connect to the Unix socket
+// at Socket instead of Host and Port. A positive PacketSize packs metrics
+// into packets of up to that many bytes rather than sending one each.
+//
+// Tags, together with those of the target being polled, are either added
+// to the metric path before the host (TagStyle path, the default, in key
+// order) or appended to each metric as DogStatsD tags (TagStyle dogstatsd).
+// Relabel rules rename hosts before they become part of metric names,
+// Processors transform metrics before they are sent and Rollup sends
+// summaries of frequently sampled gauges in place of every sample.
+//
+// Naming selects a preset layout of metric names: default
+// (<env>.<cluster>.<host>.<metric>), graphite (mongodb.<host>.<metric>),
+// or datadog and telegraf, which send mongodb.<metric> in that collector's
+// spelling with the host, env and cluster as DogStatsD tags.
+type Statsd struct {
+	Transport  string            "transport"
+	Host       string            "host"
+	Port       int               "port"
+	Socket     string            "socket"
+	Env        string            "env"
+	Cluster    string            "cluster"
+	PacketSize int               "packet_size"
+	Tags       map[string]string "tags"
+	TagStyle   string            "tag_style"
+	Relabel    []Relabel         "relabel"
+	Naming     string            "naming"
+	Spool      Spool             "spool"
+	Processors []Processor       "processors"
+	Rollup     Rollup            "rollup"
+
+	// sender, when set, replaces the configured transport. ListMetrics
+	// uses it to record metrics instead of sending them.
+	sender statsd.Sender
+	// relabel holds the Relabel rules, compiled by New.
+	relabel []relabelRule
+	// windows, spools and streams are the Agent's rollup windows, spools
+	// and tcp or unix connections.
+	windows *windowStore
+	spools  *spoolStore
+	streams *streamStore
+}
+
+// Discovery finds targets dynamically instead of polling mongo.addresses.
+// At most one mechanism may be enabled.
+type Discovery struct {
+	Kubernetes Kubernetes "kubernetes"
+	Srv        Srv        "srv"
+	Consul     Consul     "consul"
+}
+
+func (d Discovery) enabled() int {
+	n := 0
+	for _, enabled := range []bool{d.Kubernetes.enabled(), d.Srv.enabled(), d.Consul.enabled()} {
+		if enabled {
+			n++
+		}
+	}
+	return n
+}
+
+// discoverer returns the enabled discoverer, or nil if targets are static.
+func (d Discovery) discoverer() (discoverer, error) {
+	switch {
+	case d.Kubernetes.enabled():
+		return newKubernetes(d.Kubernetes)
+	case d.Srv.enabled():
+		return srvDiscoverer{d.Srv}, nil
+	case d.Consul.enabled():
+		return newConsul(d.Consul), nil
+	}
+	return nil, nil
+}
+
+// refresh returns how often the enabled discoverer is relisted.
+func (d Discovery) refresh() time.Duration {
+	switch {
+	case d.Srv.enabled():
+		return d.Srv.Refresh
+	case d.Consul.enabled():
+		return d.Consul.Refresh
+	}
+	return d.Kubernetes.Refresh
+}
+
+// Intervals holds the polling interval of each collector. A zero
+// interval disables the collector.
+type Intervals struct {
+	ServerStatus time.Duration "server_status"
+	DbStats      time.Duration "db_stats"
+	ReplSet      time.Duration "repl_set"
+	ConnPool     time.Duration "conn_pool"
+	Balancer     time.Duration "balancer"
+}
+
+// Schedule spreads polls over time. Align starts polls on wall-clock
+// multiples of the interval so graphs from different hosts line up, and
+// Jitter delays each poll by a random amount up to its value so a fleet of
+// agents does not hit Mongo and statsd in lockstep. At most MaxConcurrency
+// polls run at once, across every collector and target.
+type Schedule struct {
+	Jitter         time.Duration "jitter"
+	Align          bool          "align"
+	MaxConcurrency int           "max_concurrency"
+}
+
+func (s Schedule) jitter() time.Duration {
+	if s.Jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(s.Jitter)))
+}
+
+// Metrics enables optional, more expensive metric families. Paths are
+// dot-separated patterns of serverStatus fields to emit as gauges under
+// server_status., in addition to the built-in metrics; "*" matches one path
+// component and "**" any number of them. AllNumeric emits every numeric
+// field, including ones added by future server releases.
+//
+// ClusterAggregates also emits rollups across every target under cluster.
+//
+// Counters selects how cumulative operation counters are sent: absolute
+// (the default) as gauges of their current value, or delta as statsd
+// counters of their change since the previous poll.
+type Metrics struct {
+	Counters          string   "counters"
+	LatencyHistograms bool     "latency_histograms"
+	Paths             []string "paths"
+	AllNumeric        bool     "all_numeric"
+	ClusterAggregates bool     "cluster_aggregates"
+	Units             Units    "units"
+}
+
+func (m Metrics) patterns() []string {
+	if m.AllNumeric {
+		return []string{"**"}
+	}
+	return m.Paths
+}
+
+type Config struct {
+	Intervals Intervals "intervals"
+	Schedule  Schedule  "schedule"
+	Metrics   Metrics   "metrics"
+	Mongo     Mongo     "mongo"
+	Statsd    Statsd    "statsd"
+	Discovery Discovery "discovery"
+	Admin     Admin     "admin"
+	Leader    Leader    "leader"
+	// LogLevel is the level the command logs at. The level is process-wide
+	// and New leaves it alone; programs embedding an Agent set it with
+	// SetLogLevel.
+	LogLevel string "log_level"
+
+	// Targets, when set, replace Mongo.Addresses with a list of targets,
+	// each of which may send its metrics to its own statsd.
+	Targets []StaticTarget "targets"
+
+	CustomCommands []CustomCommand "custom_commands"
+	Alerts         []Alert         "alerts"
+
+	// aggregate, when set, collects the results of one round of polls
+	// over every target for the cluster aggregates.
+	aggregate *clusterAggregate
+	// state is what the Agent remembers between polls.
+	state *state
+}
+
+const defaultMongoAddress = "localhost:27017"
+
+// DefaultConfig returns the configuration the agent runs with when none
+// of it is overridden.
+func DefaultConfig() Config {
+	return Config{
+		Intervals: Intervals{
+			ServerStatus: 5 * time.Second,
+		},
+		Schedule: Schedule{
+			MaxConcurrency: 4,
+		},
+		Metrics: Metrics{
+			Counters: counterModeAbsolute,
+			Units:    Units{Memory: unitMegabytes, Time: unitNative},
+		},
+		Mongo: Mongo{
+			Addresses: []string{defaultMongoAddress},
+		},
+		Statsd: Statsd{
+			Transport: transportUDP,
+			Host:      "localhost",
+			Port:      8125,
+			Env:       "dev",
+			Cluster:   "0",
+			TagStyle:  tagStylePath,
+			Naming:    namingDefault,
+		},
+		LogLevel: LevelInfo.String(),
+		Leader: Leader{
+			Name:       "mgo-statsd",
+			TTL:        15 * time.Second,
+			Database:   "mgo_statsd",
+			Collection: "leader",
+		},
+		Discovery: Discovery{
+			Kubernetes: Kubernetes{
+				Port:    27017,
+				Refresh: 30 * time.Second,
+			},
+			Srv: Srv{
+				Refresh: time.Minute,
+			},
+			Consul: Consul{
+				Address: "127.0.0.1:8500",
+				Refresh: 30 * time.Second,
+			},
+		},
+	}
+}
+
+// normalize turns a single mongodb+srv:// address into SRV discovery, and
+// drops the default mongo.addresses when targets come from elsewhere, so
+// the mongo leader lock isn't taken on a localhost that isn't monitored.
+// Every remaining address is normalized, and repeats are dropped.
+func (c *Config) normalize() {
+	if len(c.Mongo.Addresses) == 1 && strings.HasPrefix(c.Mongo.Addresses[0], srvScheme) {
+		// Only the host name is used; any path or options are ignored.
+		name := strings.TrimPrefix(c.Mongo.Addresses[0], srvScheme)
+		c.Discovery.Srv.Name = strings.SplitN(name, "/", 2)[0]
+		c.Mongo.Addresses = nil
+	}
+	if len(c.Mongo.Addresses) == 1 && c.Mongo.Addresses[0] == defaultMongoAddress && (len(c.Targets) > 0 || c.Discovery.enabled() > 0) {
+		c.Mongo.Addresses = nil
+	}
+	c.Mongo.Addresses = normalizeAddresses(c.Mongo.Addresses)
+
+	targets := make([]StaticTarget, len(c.Targets))
+	for i, t := range c.Targets {
+		t.Addresses = normalizeAddresses(t.Addresses)
+		targets[i] = t
+	}
+	c.Targets = targets
+}
+
+// Validate reports every problem with the configuration at once rather
+// than stopping at the first. It checks c as New will run it, so a single
+// mongodb+srv:// address is accepted as SRV discovery.
+func (c Config) Validate() error {
+	c.normalize()
+	var errs configErrors
+
+	if c.Intervals.ServerStatus < 0 {
+		errs = append(errs, "intervals.server_status must not be negative")
+	}
+	if c.Intervals.DbStats < 0 {
+		errs = append(errs, "intervals.db_stats must not be negative")
+	}
+	if c.Intervals.ReplSet < 0 {
+		errs = append(errs, "intervals.repl_set must not be negative")
+	}
+	if c.Intervals.ConnPool < 0 {
+		errs = append(errs, "intervals.conn_pool must not be negative")
+	}
+	if c.Intervals.Balancer < 0 {
+		errs = append(errs, "intervals.balancer must not be negative")
+	}
+	if _, err := ParseLevel(c.LogLevel); err != nil {
+		errs = append(errs, "log_level: "+err.Error())
+	}
+	if c.Metrics.Counters != counterModeAbsolute && c.Metrics.Counters != counterModeDelta {
+		errs = append(errs, fmt.Sprintf("metrics.counters %q is not one of absolute and delta", c.Metrics.Counters))
+	}
+	if c.Metrics.Units.Memory != unitMegabytes && c.Metrics.Units.Memory != unitBytes {
+		errs = append(errs, fmt.Sprintf("metrics.units.memory %q is not one of megabytes and bytes", c.Metrics.Units.Memory))
+	}
+	if c.Metrics.Units.Time != unitNative && c.Metrics.Units.Time != unitMs {
+		errs = append(errs, fmt.Sprintf("metrics.units.time %q is not one of native and ms", c.Metrics.Units.Time))
+	}
+	if c.Schedule.Jitter < 0 {
+		errs = append(errs, "schedule.jitter must not be negative")
+	}
+	if c.Schedule.MaxConcurrency < 1 {
+		errs = append(errs, "schedule.max_concurrency must be at least 1")
+	}
+	if len(c.Mongo.Addresses) == 0 && len(c.Targets) == 0 && c.Discovery.enabled() == 0 {
+		errs = append(errs, "mongo.addresses must not be empty")
+	}
+	if len(c.Targets) > 0 && c.Discovery.enabled() > 0 {
+		errs = append(errs, "targets and discovery are mutually exclusive")
+	}
+	for i, t := range c.Targets {
+		errs = append(errs, t.validate(i)...)
+	}
+	for _, addr := range c.Mongo.Addresses {
+		if len(addr) == 0 {
+			errs = append(errs, "mongo.addresses must not contain empty addresses")
+		} else if !strings.HasPrefix(addr, srvScheme) && !validAddress(addr) {
+			errs = append(errs, fmt.Sprintf("mongo.addresses %q is not host:port; write IPv6 addresses with a port as [host]:port", addr))
+		}
+	}
+	if c.Mongo.PassFrom.sources() > 1 {
+		errs = append(errs, "mongo.pass_from must set only one of file, env and command")
+	}
+	if c.Mongo.PassFrom.sources() > 0 && len(c.Mongo.Pass) > 0 {
+		errs = append(errs, "mongo.pass and mongo.pass_from are mutually exclusive")
+	}
+	if (len(c.Mongo.Pass) > 0 || c.Mongo.PassFrom.sources() > 0) && len(c.Mongo.User) == 0 {
+		errs = append(errs, "mongo.pass is set but mongo.user is empty")
+	}
+	if c.Mongo.AuthMechanism == authAWS {
+		errs = append(errs, "mongo.auth_mechanism MONGODB-AWS is not supported by the mgo driver; use MONGODB-X509 or a password from mongo.pass_from")
+	}
+	if c.Mongo.AuthMechanism == authX509 {
+		if !c.Mongo.TLS.Enabled || len(c.Mongo.TLS.CertFile) == 0 {
+			errs = append(errs, "mongo.auth_mechanism MONGODB-X509 needs mongo.tls.enabled and mongo.tls.cert_file")
+		}
+		if len(c.Mongo.Pass) > 0 || c.Mongo.PassFrom.sources() > 0 {
+			errs = append(errs, "mongo.pass is not used with MONGODB-X509")
+		}
+	}
+	if len(c.Mongo.TLS.CertFile) == 0 && len(c.Mongo.TLS.KeyFile) > 0 {
+		errs = append(errs, "mongo.tls.key_file is set but mongo.tls.cert_file is empty")
+	}
+	switch c.Statsd.Transport {
+	case transportUDP, transportTCP:
+		if len(c.Statsd.Host) == 0 {
+			errs = append(errs, "statsd.host must not be empty")
+		}
+		if c.Statsd.Port <= 0 || c.Statsd.Port > 65535 {
+			errs = append(errs, fmt.Sprintf("statsd.port %d is out of range", c.Statsd.Port))
+		}
+	case transportUnix, transportUnixgram:
+		if len(c.Statsd.Socket) == 0 {
+			errs = append(errs, "statsd.socket is required with the "+c.Statsd.Transport+" transport")
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("statsd.transport %q is not one of udp, tcp, unix and unixgram", c.Statsd.Transport))
+	}
+	if c.Statsd.TagStyle != tagStylePath && c.Statsd.TagStyle != tagStyleDogStatsd {
+		errs = append(errs, fmt.Sprintf("statsd.tag_style %q is not one of path and dogstatsd", c.Statsd.TagStyle))
+	}
+	if c.Statsd.Spool.Size < 0 {
+		errs = append(errs, "statsd.spool.size must not be negative")
+	}
+	if len(c.Statsd.Spool.Path) > 0 && c.Statsd.Spool.Size == 0 {
+		errs = append(errs, "statsd.spool.path is set but statsd.spool.size is 0")
+	}
+	if _, ok := namings[c.Statsd.Naming]; !ok {
+		errs = append(errs, fmt.Sprintf("statsd.naming %q is not one of default, graphite, datadog and telegraf", c.Statsd.Naming))
+	}
+	if c.Leader.enabled() {
+		if c.Leader.Lock != leaderLockMongo && c.Leader.Lock != leaderLockKubernetes {
+			errs = append(errs, fmt.Sprintf("leader.lock %q is not one of mongo and kubernetes", c.Leader.Lock))
+		}
+		if len(c.Leader.Name) == 0 {
+			errs = append(errs, "leader.name must not be empty")
+		}
+		if c.Leader.TTL < 3*time.Second {
+			errs = append(errs, "leader.ttl must be at least 3s")
+		}
+	}
+	if c.Discovery.enabled() > 1 {
+		errs = append(errs, "discovery must enable only one of kubernetes, srv and consul")
+	}
+	if c.Discovery.Srv.enabled() && c.Discovery.Srv.Refresh <= 0 {
+		errs = append(errs, "discovery.srv.refresh must be positive")
+	}
+	if c.Discovery.Consul.enabled() && c.Discovery.Consul.Refresh <= 0 {
+		errs = append(errs, "discovery.consul.refresh must be positive")
+	}
+	if c.Discovery.Consul.TokenFrom.sources() > 1 {
+		errs = append(errs, "discovery.consul.token_from must set only one of file, env and command")
+	}
+	if c.Discovery.Consul.TokenFrom.sources() > 0 && len(c.Discovery.Consul.Token) > 0 {
+		errs = append(errs, "discovery.consul.token and discovery.consul.token_from are mutually exclusive")
+	}
+	for _, addr := range c.Mongo.Addresses {
+		if strings.HasPrefix(addr, srvScheme) {
+			errs = append(errs, "mongo.addresses may only hold a single mongodb+srv:// address")
+			break
+		}
+	}
+	if c.Discovery.Kubernetes.enabled() {
+		if c.Discovery.Kubernetes.Port <= 0 || c.Discovery.Kubernetes.Port > 65535 {
+			errs = append(errs, fmt.Sprintf("discovery.kubernetes.port %d is out of range", c.Discovery.Kubernetes.Port))
+		}
+		if c.Discovery.Kubernetes.Refresh <= 0 {
+			errs = append(errs, "discovery.kubernetes.refresh must be positive")
+		}
+	}
+	for _, r := range c.Statsd.Relabel {
+		if _, err := r.compile(); err != nil {
+			errs = append(errs, "statsd.relabel: "+err.Error())
+		}
+	}
+	for _, p := range c.Statsd.Processors {
+		errs = append(errs, p.validate()...)
+	}
+	errs = append(errs, c.Statsd.Rollup.validate()...)
+	if c.Statsd.PacketSize < 0 {
+		errs = append(errs, "statsd.packet_size must not be negative")
+	}
+	if len(c.Statsd.Env) == 0 {
+		errs = append(errs, "statsd.env must not be empty")
+	}
+
+	for _, pattern := range c.Metrics.Paths {
+		for _, component := range strings.Split(pattern, ".") {
+			if _, err := path.Match(component, ""); err != nil {
+				errs = append(errs, fmt.Sprintf("metrics.paths pattern %q is malformed", pattern))
+				break
+			}
+		}
+	}
+
+	for _, a := range c.Alerts {
+		if _, err := parseRule(a.Rule); err != nil {
+			errs = append(errs, "alerts: "+err.Error())
+		}
+	}
+
+	names := make(map[string]bool)
+	for _, custom := range c.CustomCommands {
+		errs = append(errs, custom.validate()...)
+		if names[custom.Name] {
+			errs = append(errs, "custom_commands."+custom.Name+" is defined more than once")
+		}
+		names[custom.Name] = true
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package mgostatsd
+
+import (
+	"testing"
+)
+
+func TestValidateSrvAddress(t *testing.T) {
+	tests := []struct {
+		addresses []string
+		ok        bool
+	}{
+		{[]string{"mongodb+srv://cluster.example.com"}, true},
+		{[]string{"mongodb+srv://cluster.example.com/admin?ssl=true"}, true},
+		{[]string{"mongodb+srv://a.example.com", "mongodb+srv://b.example.com"}, false},
+		{[]string{"db1.example.com:27017", "mongodb+srv://cluster.example.com"}, false},
+	}
+	for _, tt := range tests {
+		config := DefaultConfig()
+		config.Mongo.Addresses = tt.addresses
+		err := config.Validate()
+		if (err == nil) != tt.ok {
+			t.Errorf("Validate with mongo.addresses %q: %v, want ok %v", tt.addresses, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package mgostatsd
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// configErrors collects every problem found while loading the
+// configuration so they can be reported together at startup.
+type configErrors []string
+
+func (e configErrors) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e, "\n  ")
+}
+
+// IsConfigError reports whether err is an invalid configuration, as
+// returned by LoadYAML, Validate and New, rather than a failure to reach
+// Mongo or statsd.
+func IsConfigError(err error) bool {
+	_, ok := err.(configErrors)
+	return ok
+}
+
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${NAME} references with the value of the environment
+// variable NAME. Unlike os.ExpandEnv, bare $ signs (common in passwords)
+// are left alone and undefined variables are an error.
+func expandEnv(data []byte) ([]byte, error) {
+	var errs configErrors
+	expanded := envReference.ReplaceAllFunc(data, func(ref []byte) []byte {
+		name := string(envReference.FindSubmatch(ref)[1])
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			errs = append(errs, fmt.Sprintf("environment variable %s is not set", name))
+		}
+		return []byte(value)
+	})
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return expanded, nil
+}
+
+// LoadYAML decodes the YAML file at path over cfg, so keys missing from
+// the file keep their current values. ${NAME} references are replaced with
+// environment variables first, and unknown keys are rejected.
+func LoadYAML(path string, cfg *Config) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	data, err = expandEnv(data)
+	if err != nil {
+		return err
+	}
+
+	err = yaml.UnmarshalStrict(data, cfg)
+	if terr, ok := err.(*yaml.TypeError); ok {
+		errs := make(configErrors, len(terr.Errors))
+		for i, e := range terr.Errors {
+			errs[i] = path + ": " + e
+		}
+		return errs
+	}
+	return err
+}
+
+const redacted = "<redacted>"
+
+// Redacted returns a copy of c with every credential replaced, so it can
+// be printed or logged.
+func (c Config) Redacted() Config {
+	if len(c.Mongo.Pass) > 0 {
+		c.Mongo.Pass = redacted
+	}
+	if len(c.Discovery.Consul.Token) > 0 {
+		c.Discovery.Consul.Token = redacted
+	}
+	return c
+}
+
+// DumpYAML renders c, with credentials redacted, in the format LoadYAML
+// reads.
+func (c Config) DumpYAML() ([]byte, error) {
+	return yaml.Marshal(c.Redacted())
+}
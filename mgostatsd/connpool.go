@@ -0,0 +1,112 @@
+package mgostatsd
+
+import (
+	"github.com/cactus/go-statsd-client/statsd"
+	"gopkg.in/mgo.v2"
+	"sort"
+	"time"
+)
+
+type ConnPoolHost struct {
+	InUse      int64 "inUse"
+	Available  int64 "available"
+	Created    int64 "created"
+	Refreshing int64 "refreshing"
+}
+
+type ConnPoolStats struct {
+	TotalInUse      int64                   "totalInUse"
+	TotalAvailable  int64                   "totalAvailable"
+	TotalCreated    int64                   "totalCreated"
+	TotalRefreshing int64                   "totalRefreshing"
+	Hosts           map[string]ConnPoolHost "hosts"
+}
+
+func connPoolStats(session *mgo.Session) (ConnPoolStats, error) {
+	var s ConnPoolStats
+	err := session.Run("connPoolStats", &s)
+	return s, err
+}
+
+func pushConnPoolHost(client statsd.Statter, prefix string, host ConnPoolHost) error {
+	var err error
+
+	err = client.Gauge(prefix+"in_use", host.InUse, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge(prefix+"available", host.Available, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge(prefix+"created", host.Created, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge(prefix+"refreshing", host.Refreshing, 1.0)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// pushConnPoolStats emits the totals of the outgoing connection pools a
+// mongos or mongod keeps to other members, and the same figures per
+// remote host under conn_pool.hosts.<host>.
+func pushConnPoolStats(client statsd.Statter, stats ConnPoolStats) error {
+	err := pushConnPoolHost(client, "conn_pool.", ConnPoolHost{
+		InUse:      stats.TotalInUse,
+		Available:  stats.TotalAvailable,
+		Created:    stats.TotalCreated,
+		Refreshing: stats.TotalRefreshing,
+	})
+	if err != nil {
+		return err
+	}
+
+	hosts := make([]string, 0, len(stats.Hosts))
+	for host := range stats.Hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	for _, host := range hosts {
+		err = pushConnPoolHost(client, "conn_pool.hosts."+metricName(host)+".", stats.Hosts[host])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func collectConnPool(session *mgo.Session, config Config) (err error) {
+	host, err := hostName(session)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	stats, err := connPoolStats(session)
+	if err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+
+	client, err := newStatter(config.Statsd, host)
+	if err != nil {
+		return err
+	}
+	defer closeStatter(client, &err)
+
+	err = pushCollectTime(client, "conn_pool", elapsed)
+	if err != nil {
+		return err
+	}
+
+	return pushConnPoolStats(client, stats)
+}
@@ -0,0 +1,107 @@
+package mgostatsd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Consul discovers one direct target per instance of Service (optionally
+// only those carrying Tag) whose health checks pass, asking the agent at
+// Address every Refresh. Instances that turn unhealthy stop being polled.
+type Consul struct {
+	Address    string        "address"
+	Service    string        "service"
+	Tag        string        "tag"
+	Datacenter string        "datacenter"
+	Token      string        "token"
+	TokenFrom  Secret        "token_from"
+	Refresh    time.Duration "refresh"
+}
+
+func (c Consul) enabled() bool {
+	return len(c.Service) > 0
+}
+
+type ConsulNode struct {
+	Node    string
+	Address string
+}
+
+type ConsulService struct {
+	Address string
+	Port    int
+}
+
+type ConsulServiceEntry struct {
+	Node    ConsulNode
+	Service ConsulService
+}
+
+type consulDiscoverer struct {
+	config Consul
+	http   *http.Client
+}
+
+func newConsul(config Consul) *consulDiscoverer {
+	return &consulDiscoverer{config: config, http: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (d *consulDiscoverer) discover() ([]Target, error) {
+	address := d.config.Address
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	query := url.Values{"passing": {"true"}}
+	if len(d.config.Tag) > 0 {
+		query.Set("tag", d.config.Tag)
+	}
+	if len(d.config.Datacenter) > 0 {
+		query.Set("dc", d.config.Datacenter)
+	}
+
+	req, err := http.NewRequest("GET", address+"/v1/health/service/"+url.PathEscape(d.config.Service)+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(d.config.Token) > 0 {
+		req.Header.Set("X-Consul-Token", d.config.Token)
+	}
+
+	resp, err := d.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("consul: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var entries []ConsulServiceEntry
+	err = json.NewDecoder(resp.Body).Decode(&entries)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make([]Target, 0, len(entries))
+	for _, e := range entries {
+		// Services registered without an address use their node's.
+		host := e.Service.Address
+		if len(host) == 0 {
+			host = e.Node.Address
+		}
+		targets = append(targets, Target{
+			Addresses: []string{net.JoinHostPort(host, strconv.Itoa(e.Service.Port))},
+			Direct:    true,
+		})
+	}
+	return targets, nil
+}
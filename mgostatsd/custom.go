@@ -0,0 +1,155 @@
+package mgostatsd
+
+import (
+	"fmt"
+	"github.com/cactus/go-statsd-client/statsd"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"gopkg.in/yaml.v2"
+	"sort"
+	"time"
+)
+
+// CustomCommand is a user-defined collector: either an admin command run
+// against Database, or an aggregation Pipeline run against Collection in
+// Database. Metrics maps dot-separated paths in the result to metric names,
+// which are emitted as gauges under custom.<Name>. Pipeline results are an
+// array, so their paths start with the index of the result document.
+type CustomCommand struct {
+	Name       string            "name"
+	Interval   time.Duration     "interval"
+	Database   string            "database"
+	Command    yaml.MapSlice     "command"
+	Collection string            "collection"
+	Pipeline   []yaml.MapSlice   "pipeline"
+	Metrics    map[string]string "metrics"
+}
+
+// toBSON converts a value decoded from YAML into its BSON equivalent.
+// MapSlice keeps key order, which matters because Mongo reads the command
+// name from the first key.
+func toBSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case yaml.MapSlice:
+		doc := make(bson.D, 0, len(v))
+		for _, item := range v {
+			doc = append(doc, bson.DocElem{Name: fmt.Sprint(item.Key), Value: toBSON(item.Value)})
+		}
+		return doc
+	case map[interface{}]interface{}:
+		doc := make(bson.M, len(v))
+		for key, item := range v {
+			doc[fmt.Sprint(key)] = toBSON(item)
+		}
+		return doc
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = toBSON(item)
+		}
+		return list
+	}
+	return value
+}
+
+func (c CustomCommand) run(session *mgo.Session) (interface{}, error) {
+	db := session.DB(c.Database)
+	if len(c.Pipeline) > 0 {
+		pipeline := make([]interface{}, len(c.Pipeline))
+		for i, stage := range c.Pipeline {
+			pipeline[i] = toBSON(stage)
+		}
+		var results []interface{}
+		err := db.C(c.Collection).Pipe(pipeline).All(&results)
+		return results, err
+	}
+
+	var result bson.M
+	err := db.Run(toBSON(c.Command), &result)
+	return result, err
+}
+
+func pushCustom(client statsd.Statter, c CustomCommand, result interface{}) error {
+	paths := make([]string, 0, len(c.Metrics))
+	for path := range c.Metrics {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	prefix := "custom." + metricName(c.Name) + "."
+	for _, path := range paths {
+		value, ok := lookup(result, path)
+		if !ok {
+			continue
+		}
+		n, ok := numeric(value)
+		if !ok {
+			continue
+		}
+		err := client.Gauge(prefix+c.Metrics[path], n, 1.0)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c CustomCommand) collector(default_interval time.Duration) collector {
+	interval := c.Interval
+	if interval == 0 {
+		interval = default_interval
+	}
+
+	return collector{"custom." + c.Name, interval, func(session *mgo.Session, config Config) (err error) {
+		host, err := hostName(session)
+		if err != nil {
+			return err
+		}
+
+		start := time.Now()
+		result, err := c.run(session)
+		if err != nil {
+			return err
+		}
+		elapsed := time.Since(start)
+
+		client, err := newStatter(config.Statsd, host)
+		if err != nil {
+			return err
+		}
+		defer closeStatter(client, &err)
+
+		err = pushCollectTime(client, "custom."+metricName(c.Name), elapsed)
+		if err != nil {
+			return err
+		}
+
+		return pushCustom(client, c, result)
+	}}
+}
+
+func (c CustomCommand) validate() []string {
+	var errs []string
+	name := "custom_commands." + c.Name
+
+	if len(c.Name) == 0 {
+		errs = append(errs, "custom_commands entries must have a name")
+	}
+	if c.Interval < 0 {
+		errs = append(errs, name+".interval must not be negative")
+	}
+	if len(c.Database) == 0 {
+		errs = append(errs, name+".database must not be empty")
+	}
+	if (len(c.Command) > 0) == (len(c.Pipeline) > 0) {
+		errs = append(errs, name+" must set exactly one of command and pipeline")
+	}
+	if len(c.Pipeline) > 0 && len(c.Collection) == 0 {
+		errs = append(errs, name+".collection is required with a pipeline")
+	}
+	if len(c.Metrics) == 0 {
+		errs = append(errs, name+".metrics must not be empty")
+	}
+	return errs
+}
@@ -0,0 +1,165 @@
+package mgostatsd
+
+import (
+	"github.com/cactus/go-statsd-client/statsd"
+	"gopkg.in/mgo.v2"
+	"time"
+)
+
+type DbStats struct {
+	Db          string "db"
+	Collections int64  "collections"
+	Objects     int64  "objects"
+	DataSize    int64  "dataSize"
+	StorageSize int64  "storageSize"
+	Indexes     int64  "indexes"
+	IndexSize   int64  "indexSize"
+	FsUsedSize  int64  "fsUsedSize"
+	FsTotalSize int64  "fsTotalSize"
+}
+
+type ListDatabases struct {
+	TotalSize int64 "totalSize"
+}
+
+func dbStats(session *mgo.Session) ([]DbStats, error) {
+	names, err := session.DatabaseNames()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]DbStats, 0, len(names))
+	for _, name := range names {
+		var s DbStats
+		err := session.DB(name).Run("dbStats", &s)
+		if isUnauthorized(err) {
+			// Users are often granted only some databases.
+			logf(LevelDebug, "dbStats %s: %s", name, err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, nil
+}
+
+func listDatabases(session *mgo.Session) (ListDatabases, error) {
+	var l ListDatabases
+	err := session.Run("listDatabases", &l)
+	return l, err
+}
+
+// pushStorage emits the size of all databases together and, on 4.4+ where
+// dbStats reports the filesystem holding the dbpath, how full that
+// filesystem is. Every database lives on the same filesystem, so the first
+// dbStats carrying the figures is used.
+func pushStorage(client statsd.Statter, list ListDatabases, stats []DbStats) error {
+	var err error
+
+	err = client.Gauge("storage.total_size", list.TotalSize, 1.0)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range stats {
+		if s.FsTotalSize == 0 {
+			continue
+		}
+
+		err = client.Gauge("storage.fs_used_size", s.FsUsedSize, 1.0)
+		if err != nil {
+			return err
+		}
+
+		err = client.Gauge("storage.fs_total_size", s.FsTotalSize, 1.0)
+		if err != nil {
+			return err
+		}
+
+		err = client.Gauge("storage.fs_used_percent", s.FsUsedSize*100/s.FsTotalSize, 1.0)
+		if err != nil {
+			return err
+		}
+		break
+	}
+
+	return nil
+}
+
+func pushDbStats(client statsd.Statter, stats DbStats) error {
+	var err error
+	prefix := "db." + metricName(stats.Db) + "."
+
+	err = client.Gauge(prefix+"collections", stats.Collections, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge(prefix+"objects", stats.Objects, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge(prefix+"data_size", stats.DataSize, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge(prefix+"storage_size", stats.StorageSize, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge(prefix+"indexes", stats.Indexes, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge(prefix+"index_size", stats.IndexSize, 1.0)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func collectDbStats(session *mgo.Session, config Config) (err error) {
+	host, err := hostName(session)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	stats, err := dbStats(session)
+	if err != nil {
+		return err
+	}
+
+	list, err := listDatabases(session)
+	if err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+
+	client, err := newStatter(config.Statsd, host)
+	if err != nil {
+		return err
+	}
+	defer closeStatter(client, &err)
+
+	err = pushCollectTime(client, "db_stats", elapsed)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range stats {
+		err = pushDbStats(client, s)
+		if err != nil {
+			return err
+		}
+	}
+
+	return pushStorage(client, list, stats)
+}
@@ -0,0 +1,63 @@
+package mgostatsd
+
+import (
+	"github.com/cactus/go-statsd-client/statsd"
+	"sync"
+)
+
+// counterStore remembers the last value seen for cumulative server
+// counters so collectors can emit how much they moved since the previous
+// poll. Keys should include the host so servers don't share state.
+type counterStore struct {
+	mu   sync.Mutex
+	last map[string]int64
+}
+
+// delta records value under key and returns its change since the last
+// call. ok is false on the first sample, when there is nothing to compare,
+// and when the counter went backwards: server counters only decrease when
+// the server restarted, and the interval spanning the restart is skipped
+// rather than reported as a huge negative or bogus change. The change is
+// 0 whenever ok is false.
+func (c *counterStore) delta(key string, value int64) (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	last, ok := c.last[key]
+	c.last[key] = value
+	if !ok {
+		return 0, false
+	}
+	if value < last {
+		logf(LevelDebug, "counter %s reset from %d to %d", key, last, value)
+		return 0, false
+	}
+	return value - last, true
+}
+
+// reset forgets every sample, so the next one of each counter is treated
+// as the first.
+func (c *counterStore) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.last = make(map[string]int64)
+}
+
+const (
+	counterModeAbsolute = "absolute"
+	counterModeDelta    = "delta"
+)
+
+// pushCounter emits a cumulative server counter as a gauge of its value,
+// or in delta mode as a statsd counter of its change since the last poll.
+func pushCounter(client statsd.Statter, counters *counterStore, mode string, host string, name string, value int64) error {
+	if mode != counterModeDelta {
+		return client.Gauge(name, value, 1.0)
+	}
+	delta, ok := counters.delta(host+"."+name, value)
+	if !ok {
+		return nil
+	}
+	return client.Inc(name, delta, 1.0)
+}
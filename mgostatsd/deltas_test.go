@@ -0,0 +1,90 @@
+package mgostatsd
+
+import (
+	"testing"
+)
+
+func TestCounterStoreDelta(t *testing.T) {
+	type sample struct {
+		key   string
+		value int64
+		delta int64
+		ok    bool
+	}
+	tests := []struct {
+		name    string
+		samples []sample
+	}{
+		{
+			name:    "first sample",
+			samples: []sample{{"db1.ops.query", 100, 0, false}},
+		},
+		{
+			name: "increase",
+			samples: []sample{
+				{"db1.ops.query", 100, 0, false},
+				{"db1.ops.query", 150, 50, true},
+				{"db1.ops.query", 150, 0, true},
+				{"db1.ops.query", 175, 25, true},
+			},
+		},
+		{
+			name: "reset skips the interval and restarts from the new value",
+			samples: []sample{
+				{"db1.ops.query", 100, 0, false},
+				{"db1.ops.query", 150, 50, true},
+				{"db1.ops.query", 20, 0, false},
+				{"db1.ops.query", 30, 10, true},
+			},
+		},
+		{
+			name: "a target that disappears leaves the others alone",
+			samples: []sample{
+				{"db1.ops.query", 100, 0, false},
+				{"db2.ops.query", 500, 0, false},
+				{"db1.ops.query", 110, 10, true},
+				{"db2.ops.query", 600, 100, true},
+				{"db1.ops.query", 120, 10, true},
+				{"db1.ops.query", 130, 10, true},
+			},
+		},
+		{
+			name: "a target that comes back restarted is skipped once",
+			samples: []sample{
+				{"db2.ops.query", 500, 0, false},
+				{"db1.ops.query", 100, 0, false},
+				{"db1.ops.query", 110, 10, true},
+				{"db2.ops.query", 5, 0, false},
+				{"db2.ops.query", 8, 3, true},
+			},
+		},
+		{
+			name: "a target that comes back without restarting reports the change since it was last seen",
+			samples: []sample{
+				{"db2.ops.query", 500, 0, false},
+				{"db1.ops.query", 100, 0, false},
+				{"db1.ops.query", 110, 10, true},
+				{"db2.ops.query", 900, 400, true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		counters := &counterStore{last: make(map[string]int64)}
+		for i, s := range tt.samples {
+			delta, ok := counters.delta(s.key, s.value)
+			if delta != s.delta || ok != s.ok {
+				t.Errorf("%s: sample %d delta(%q, %d) = %d, %t, want %d, %t", tt.name, i, s.key, s.value, delta, ok, s.delta, s.ok)
+			}
+		}
+	}
+}
+
+func TestCounterStoreReset(t *testing.T) {
+	counters := &counterStore{last: make(map[string]int64)}
+	counters.delta("db1.ops.query", 100)
+	counters.reset()
+	delta, ok := counters.delta("db1.ops.query", 150)
+	if delta != 0 || ok {
+		t.Errorf("first delta after reset = %d, %t, want 0, false", delta, ok)
+	}
+}
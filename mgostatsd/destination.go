@@ -0,0 +1,81 @@
+package mgostatsd
+
+import (
+	"fmt"
+)
+
+// Destination overrides where the metrics of one target are sent, so one
+// agent can serve teams that each run their own statsd. Empty fields keep
+// the statsd configuration. A target sent to its own host and port also
+// gets its own spool file, the spool path suffixed with the destination.
+type Destination struct {
+	Host    string "host"
+	Port    int    "port"
+	Env     string "env"
+	Cluster string "cluster"
+}
+
+func (d Destination) apply(statsd_config Statsd) Statsd {
+	dest := destination(statsd_config)
+	if len(d.Host) > 0 {
+		statsd_config.Host = d.Host
+	}
+	if d.Port > 0 {
+		statsd_config.Port = d.Port
+	}
+	if len(d.Env) > 0 {
+		statsd_config.Env = d.Env
+	}
+	if len(d.Cluster) > 0 {
+		statsd_config.Cluster = d.Cluster
+	}
+	if len(statsd_config.Spool.Path) > 0 && destination(statsd_config) != dest {
+		statsd_config.Spool.Path += "." + metricName(hostPort(statsd_config))
+	}
+	return statsd_config
+}
+
+// StaticTarget is a target listed in the configuration, with the tags its
+// metrics carry and where they are sent.
+type StaticTarget struct {
+	Addresses []string          "addresses"
+	Tags      map[string]string "tags"
+	Statsd    Destination       "statsd"
+}
+
+func (s StaticTarget) target() Target {
+	t := Target{Addresses: s.Addresses, Tags: s.Tags}
+	if s.Statsd != (Destination{}) {
+		statsd := s.Statsd
+		t.Statsd = &statsd
+	}
+	return t
+}
+
+func (s StaticTarget) validate(i int) []string {
+	var errs []string
+	name := fmt.Sprintf("targets[%d]", i)
+
+	if len(s.Addresses) == 0 {
+		errs = append(errs, name+".addresses must not be empty")
+	}
+	for _, addr := range s.Addresses {
+		if !validAddress(addr) {
+			errs = append(errs, fmt.Sprintf("%s.addresses %q is not host:port; write IPv6 addresses with a port as [host]:port", name, addr))
+		}
+	}
+	if s.Statsd.Port < 0 || s.Statsd.Port > 65535 {
+		errs = append(errs, fmt.Sprintf("%s.statsd.port %d is out of range", name, s.Statsd.Port))
+	}
+	return errs
+}
+
+// forTarget returns config with the tags and statsd destination of t
+// applied, as every metric of t is sent with it.
+func (c Config) forTarget(t Target) Config {
+	c.Statsd.Tags = mergeTags(c.Statsd.Tags, t.Tags)
+	if t.Statsd != nil {
+		c.Statsd = t.Statsd.apply(c.Statsd)
+	}
+	return c
+}
@@ -0,0 +1,204 @@
+package mgostatsd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// expr is a parsed arithmetic expression over metric values, as used by
+// derive processors: numbers, metric names, + - * /, unary minus and
+// parentheses, with the usual precedence. A bare name is letters, digits,
+// _ and . not starting with a digit; any other name, such as one with a -
+// taken from a host or member name, is written in double quotes.
+type expr interface {
+	// eval returns the value of the expression, or false if a metric it
+	// refers to is missing or it divides by zero.
+	eval(values map[string]float64) (float64, bool)
+}
+
+type exprNumber float64
+
+func (e exprNumber) eval(values map[string]float64) (float64, bool) {
+	return float64(e), true
+}
+
+type exprMetric string
+
+func (e exprMetric) eval(values map[string]float64) (float64, bool) {
+	v, ok := values[string(e)]
+	return v, ok
+}
+
+type exprNeg struct {
+	operand expr
+}
+
+func (e exprNeg) eval(values map[string]float64) (float64, bool) {
+	v, ok := e.operand.eval(values)
+	return -v, ok
+}
+
+type exprBinary struct {
+	op          byte
+	left, right expr
+}
+
+func (e exprBinary) eval(values map[string]float64) (float64, bool) {
+	l, ok := e.left.eval(values)
+	if !ok {
+		return 0, false
+	}
+	r, ok := e.right.eval(values)
+	if !ok {
+		return 0, false
+	}
+	switch e.op {
+	case '+':
+		return l + r, true
+	case '-':
+		return l - r, true
+	case '*':
+		return l * r, true
+	case '/':
+		if r == 0 {
+			return 0, false
+		}
+		return l / r, true
+	}
+	return 0, false
+}
+
+// parseExpr parses s, and returns the metric names it refers to.
+func parseExpr(s string) (expr, []string, error) {
+	p := &exprParser{s: s}
+	e, err := p.sum()
+	if err == nil && p.peek() != 0 {
+		err = fmt.Errorf("unexpected %q at offset %d", p.s[p.i], p.i)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("expression %q: %s", s, err)
+	}
+	return e, p.metrics, nil
+}
+
+type exprParser struct {
+	s       string
+	i       int
+	metrics []string
+}
+
+// peek skips spaces and returns the next byte, or 0 at the end.
+func (p *exprParser) peek() byte {
+	for p.i < len(p.s) && (p.s[p.i] == ' ' || p.s[p.i] == '\t') {
+		p.i++
+	}
+	if p.i == len(p.s) {
+		return 0
+	}
+	return p.s[p.i]
+}
+
+func (p *exprParser) sum() (expr, error) {
+	e, err := p.product()
+	if err != nil {
+		return nil, err
+	}
+	for c := p.peek(); c == '+' || c == '-'; c = p.peek() {
+		p.i++
+		right, err := p.product()
+		if err != nil {
+			return nil, err
+		}
+		e = exprBinary{op: c, left: e, right: right}
+	}
+	return e, nil
+}
+
+func (p *exprParser) product() (expr, error) {
+	e, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for c := p.peek(); c == '*' || c == '/'; c = p.peek() {
+		p.i++
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		e = exprBinary{op: c, left: e, right: right}
+	}
+	return e, nil
+}
+
+func (p *exprParser) unary() (expr, error) {
+	if p.peek() == '-' {
+		p.i++
+		e, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return exprNeg{operand: e}, nil
+	}
+	return p.operand()
+}
+
+func (p *exprParser) operand() (expr, error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return nil, fmt.Errorf("unexpected end")
+	case c == '(':
+		p.i++
+		e, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("missing ) at offset %d", p.i)
+		}
+		p.i++
+		return e, nil
+	case c >= '0' && c <= '9' || c == '.':
+		start := p.i
+		for p.i < len(p.s) && (p.s[p.i] >= '0' && p.s[p.i] <= '9' || p.s[p.i] == '.') {
+			p.i++
+		}
+		if p.i < len(p.s) && isMetricByte(p.s[p.i]) {
+			return nil, fmt.Errorf("name at offset %d starts with a digit; write it in double quotes", start)
+		}
+		v, err := strconv.ParseFloat(p.s[start:p.i], 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed number %q", p.s[start:p.i])
+		}
+		return exprNumber(v), nil
+	case c == '"':
+		start := p.i
+		end := strings.IndexByte(p.s[start+1:], '"')
+		if end <= 0 {
+			return nil, fmt.Errorf("unterminated or empty name at offset %d", start)
+		}
+		name := p.s[start+1 : start+1+end]
+		p.i = start + end + 2
+		p.metrics = append(p.metrics, name)
+		return exprMetric(name), nil
+	case isMetricByte(c) && c != '.':
+		start := p.i
+		for p.i < len(p.s) && isMetricByte(p.s[p.i]) {
+			p.i++
+		}
+		name := p.s[start:p.i]
+		if p.i+1 < len(p.s) && p.s[p.i] == '-' && isMetricByte(p.s[p.i+1]) {
+			// Most likely a name with a hyphen, which would silently
+			// parse as a subtraction.
+			return nil, fmt.Errorf("%q is followed by - without spaces; write a name with a - in double quotes, or put spaces around - to subtract", name)
+		}
+		p.metrics = append(p.metrics, name)
+		return exprMetric(name), nil
+	}
+	return nil, fmt.Errorf("unexpected %q at offset %d", c, p.i)
+}
+
+func isMetricByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.'
+}
@@ -0,0 +1,75 @@
+package mgostatsd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseExprEval(t *testing.T) {
+	values := map[string]float64{
+		"a":              4,
+		"b":              2,
+		"zero":           0,
+		"conn.current":   30,
+		"conn.available": 70,
+		"repl.lag.db-1":  1500,
+	}
+	tests := []struct {
+		expr    string
+		want    float64
+		ok      bool
+		metrics []string
+	}{
+		{"1 + 2 * 3", 7, true, nil},
+		{"(1 + 2) * 3", 9, true, nil},
+		{"10 - 4 - 3", 3, true, nil},
+		{"12 / 4 / 3", 1, true, nil},
+		{"-2 * 3", -6, true, nil},
+		{"- -2", 2, true, nil},
+		{"-(1 + 2)", -3, true, nil},
+		{"2 * -a", -8, true, []string{"a"}},
+		{"a - b", 2, true, []string{"a", "b"}},
+		{"conn.current * 100 / (conn.current + conn.available)", 30, true, []string{"conn.current", "conn.current", "conn.available"}},
+		{`"repl.lag.db-1" / 1000`, 1.5, true, []string{"repl.lag.db-1"}},
+		{"1.5 * b", 3, true, []string{"b"}},
+		{"1 / 0", 0, false, nil},
+		{"a / zero", 0, false, []string{"a", "zero"}},
+		{"a / (b - 2)", 0, false, []string{"a", "b"}},
+		{"missing + 1", 0, false, []string{"missing"}},
+	}
+	for _, tt := range tests {
+		e, metrics, err := parseExpr(tt.expr)
+		if err != nil {
+			t.Errorf("parseExpr(%q): %s", tt.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(metrics, tt.metrics) {
+			t.Errorf("parseExpr(%q) metrics = %q, want %q", tt.expr, metrics, tt.metrics)
+		}
+		got, ok := e.eval(values)
+		if ok != tt.ok || ok && got != tt.want {
+			t.Errorf("%q = %v, %v, want %v, %v", tt.expr, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"1 +",
+		"(1 + 2",
+		"1 2",
+		"a b",
+		"* 2",
+		"1..2",
+		".a",
+		"repl.lag.db-1 / 1000",
+		"2xx + 1",
+		`""`,
+		`"repl.lag.db-1 / 1000`,
+	} {
+		if _, _, err := parseExpr(s); err == nil {
+			t.Errorf("parseExpr(%q) succeeded, want an error", s)
+		}
+	}
+}
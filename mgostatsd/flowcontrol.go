@@ -0,0 +1,64 @@
+package mgostatsd
+
+import (
+	"github.com/cactus/go-statsd-client/statsd"
+)
+
+// FlowControl is the "flowControl" section of serverStatus on 4.2 and
+// newer. When the majority commit point lags, the primary hands out at
+// most TargetRateLimit write tickets a second, and writers wait for them.
+type FlowControl struct {
+	Enabled             bool  "enabled"
+	TargetRateLimit     int64 "targetRateLimit"
+	TimeAcquiringMicros int64 "timeAcquiringMicros"
+	IsLagged            bool  "isLagged"
+	IsLaggedCount       int64 "isLaggedCount"
+}
+
+// pushFlowControl emits whether flow control is throttling writes, the
+// rate it throttles them to, and the time writers spent waiting for it and
+// the times it kicked in since the previous poll.
+func pushFlowControl(client statsd.Statter, counters *counterStore, host string, flow FlowControl) error {
+	var err error
+
+	var enabled, lagging int64
+	if flow.Enabled {
+		enabled = 1
+	}
+	if flow.IsLagged {
+		lagging = 1
+	}
+
+	err = client.Gauge("flow_control.enabled", enabled, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("flow_control.is_lagged", lagging, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("flow_control.target_rate_limit", flow.TargetRateLimit, 1.0)
+	if err != nil {
+		return err
+	}
+
+	acquiring, ok := counters.delta(host+".flow_control.time_acquiring", flow.TimeAcquiringMicros)
+	if ok {
+		err = client.Inc("flow_control.time_acquiring_ms", acquiring/1000, 1.0)
+		if err != nil {
+			return err
+		}
+	}
+
+	lagged, ok := counters.delta(host+".flow_control.lagged_count", flow.IsLaggedCount)
+	if ok {
+		err = client.Inc("flow_control.lagged_count", lagged, 1.0)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,290 @@
+//go:build integration
+// +build integration
+
+package mgostatsd
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The integration tests run the agent against real MongoDB servers, a
+// single node and a one-member replica set of every version in
+// MONGO_VERSIONS, started with the docker CLI. Metrics go over UDP to a
+// listener standing in for statsd, through the same senders as in
+// production. Every required metric must be sent, and nothing that isn't
+// required or allowed. Run them with:
+//
+//	go test -tags integration ./mgostatsd/
+//	MONGO_VERSIONS=4.4.29 go test -tags integration ./mgostatsd/
+
+// mgo speaks the legacy wire protocol, which MongoDB 5.1 stopped accepting.
+const defaultMongoVersions = "3.6.23 4.0.28 4.2.24 4.4.29 5.0.26"
+
+// statsdLine is a metric line as statsd parses it: a name safe as a
+// Graphite path, a value and a type, with an optional sample rate.
+var statsdLine = regexp.MustCompile(`^[A-Za-z0-9_.-]+:[+-]?[0-9.]+\|(c|g|ms|s)(\|@[0-9.]+)?$`)
+
+func TestIntegration(t *testing.T) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("docker not found")
+	}
+	versions := os.Getenv("MONGO_VERSIONS")
+	if len(versions) == 0 {
+		versions = defaultMongoVersions
+	}
+
+	SetLogLevel(LevelWarn)
+	for _, version := range strings.Fields(versions) {
+		for _, topology := range []string{"single", "replset"} {
+			t.Run(topology+"-"+version, func(t *testing.T) {
+				testTopology(t, version, topology)
+			})
+		}
+	}
+}
+
+func testTopology(t *testing.T, version string, topology string) {
+	addr, stop := startMongo(t, version, topology)
+	defer stop()
+
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := &udpStatsd{conn: listener, done: make(chan struct{})}
+	go received.serve()
+
+	config := DefaultConfig()
+	config.Mongo.Addresses = []string{addr}
+	config.Statsd.Host = "127.0.0.1"
+	config.Statsd.Port = listener.LocalAddr().(*net.UDPAddr).Port
+	config.Statsd.Env = "it"
+	config.Statsd.Cluster = topology
+	// The server reports its host with the port, which is picked at
+	// random.
+	config.Statsd.Relabel = []Relabel{{Match: "mongo:[0-9]+", Replace: "mongo"}}
+	config.Intervals.DbStats = time.Minute
+	if topology == "replset" {
+		config.Intervals.ReplSet = time.Minute
+	}
+
+	agent, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Twice, like list-metrics, so metrics that need a previous sample
+	// are sent too.
+	for round := 0; round < 2; round++ {
+		err = agent.CollectOnce()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(500 * time.Millisecond)
+	lines := received.close()
+
+	prefix := "it." + topology + "."
+	label := Target{Addresses: []string{addr}}.label() + "."
+	sent := make(map[string]bool)
+	for _, line := range lines {
+		if !statsdLine.MatchString(line) {
+			t.Errorf("invalid statsd line %q", line)
+			continue
+		}
+		if !strings.HasPrefix(line, prefix) {
+			t.Errorf("line %q is missing prefix %q", line, prefix)
+			continue
+		}
+		name := strings.TrimPrefix(line[:strings.Index(line, ":")], prefix)
+		if strings.HasPrefix(name, label) {
+			name = "target." + strings.TrimPrefix(name, label)
+		}
+		kind := line[strings.Index(line, "|")+1:]
+		kind = strings.SplitN(kind, "|", 2)[0]
+		sent[name+" "+metricTypes[kind]] = true
+	}
+
+	required := readFixture(t, filepath.Join("testdata", "integration", topology+".txt"))
+	allowed := readFixture(t, filepath.Join("testdata", "integration", "allowed.txt"))
+	var missing, unexpected []string
+	for _, want := range required {
+		if !sent[want] {
+			missing = append(missing, want)
+		}
+	}
+	for metric := range sent {
+		if !expectedMetric(metric, required, allowed) {
+			unexpected = append(unexpected, metric)
+		}
+	}
+	sort.Strings(unexpected)
+	if len(missing) > 0 {
+		t.Errorf("missing metrics:\n  %s", strings.Join(missing, "\n  "))
+	}
+	if len(unexpected) > 0 {
+		t.Errorf("metrics neither required nor allowed:\n  %s", strings.Join(unexpected, "\n  "))
+	}
+	if len(missing) > 0 || len(unexpected) > 0 {
+		all := make([]string, 0, len(sent))
+		for m := range sent {
+			all = append(all, m)
+		}
+		sort.Strings(all)
+		t.Logf("sent:\n  %s", strings.Join(all, "\n  "))
+	}
+}
+
+// expectedMetric reports whether metric, as "name type", is one of
+// required or matches one of the allowed patterns.
+func expectedMetric(metric string, required []string, allowed []string) bool {
+	for _, want := range required {
+		if metric == want {
+			return true
+		}
+	}
+	name, kind := splitMetric(metric)
+	for _, pattern := range allowed {
+		pattern_name, pattern_kind := splitMetric(pattern)
+		if kind == pattern_kind && matchPath(strings.Split(pattern_name, "."), strings.Split(name, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitMetric splits "name type" into the name and the type.
+func splitMetric(metric string) (string, string) {
+	i := strings.LastIndex(metric, " ")
+	if i < 0 {
+		return metric, ""
+	}
+	return metric[:i], metric[i+1:]
+}
+
+// startMongo runs mongod in a container and returns its address and a
+// function removing the container. mongod listens on the same port inside
+// and outside the container, so a replica set member's own address is
+// also the one the agent connects to.
+func startMongo(t *testing.T, version string, topology string) (string, func()) {
+	port := freePort(t)
+	args := []string{"run", "-d", "--hostname", "mongo", "-p", fmt.Sprintf("127.0.0.1:%d:%d", port, port),
+		"mongo:" + version, "--port", strconv.Itoa(port), "--bind_ip_all"}
+	if topology == "replset" {
+		args = append(args, "--replSet", "rs0")
+	}
+	id := docker(t, args...)
+	stop := func() { exec.Command("docker", "rm", "-f", id).Run() }
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+
+	eval := func(expr string) string {
+		out, _ := exec.Command("docker", "exec", id, "mongo", "--quiet", "--port", strconv.Itoa(port), "--eval", expr).Output()
+		return strings.TrimSpace(string(out))
+	}
+	waitFor := func(expr string) {
+		for i := 0; i < 60; i++ {
+			if eval(expr) == "true" {
+				return
+			}
+			time.Sleep(time.Second)
+		}
+		stop()
+		t.Fatalf("mongo %s: timed out waiting for %s", version, expr)
+	}
+
+	waitFor("db.runCommand({ping: 1}).ok == 1")
+	if topology == "replset" {
+		eval(fmt.Sprintf(`rs.initiate({_id: "rs0", members: [{_id: 0, host: %q}]})`, addr))
+		waitFor("db.isMaster().ismaster")
+	}
+	return addr, stop
+}
+
+func docker(t *testing.T, args ...string) string {
+	out, err := exec.Command("docker", args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("docker %s: %s: %s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// readFixture returns the lines of path, leaving out blanks and comments.
+func readFixture(t *testing.T, path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return lines
+}
+
+// udpStatsd collects the lines of every packet sent to conn. done is
+// closed when serve returns.
+type udpStatsd struct {
+	conn  net.PacketConn
+	done  chan struct{}
+	mu    sync.Mutex
+	lines []string
+}
+
+func (s *udpStatsd) serve() {
+	defer close(s.done)
+
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if len(line) > 0 {
+				s.lines = append(s.lines, line)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// close stops listening and returns every line received.
+func (s *udpStatsd) close() []string {
+	s.conn.Close()
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lines
+}
@@ -0,0 +1,108 @@
+package mgostatsd
+
+import (
+	"github.com/cactus/go-statsd-client/statsd"
+)
+
+// Dur is the "dur" section MMAPv1 servers report when journaling. Unlike
+// most of serverStatus it is not cumulative: every value covers only the
+// server's last group commit interval, TimeMs.Dt milliseconds long.
+type Dur struct {
+	Commits            int64   "commits"
+	JournaledMB        float64 "journaledMB"
+	WriteToDataFilesMB float64 "writeToDataFilesMB"
+	CommitsInWriteLock int64   "commitsInWriteLock"
+	TimeMs             DurTime "timeMs"
+}
+
+type DurTime struct {
+	Dt int64 "dt"
+}
+
+type Wtime struct {
+	Num         int64 "num"
+	TotalMillis int64 "totalMillis"
+}
+
+// GetLastError counts the write concern waits of the server since start:
+// Wtime for writes that waited for replication, Wtimeouts for those that
+// gave up on wtimeout.
+type GetLastError struct {
+	Wtime     Wtime "wtime"
+	Wtimeouts int64 "wtimeouts"
+}
+
+// pushDur is a no-op on servers that are not journaling. The MB figures
+// are sent in bytes, since most intervals journal well under a megabyte.
+func pushDur(client statsd.Statter, dur Dur) error {
+	var err error
+	if dur.TimeMs.Dt == 0 {
+		return nil
+	}
+
+	err = client.Gauge("dur.commits", dur.Commits, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("dur.commits_in_write_lock", dur.CommitsInWriteLock, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("dur.journaled.bytes", int64(dur.JournaledMB*1024*1024), 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("dur.write_to_data_files.bytes", int64(dur.WriteToDataFilesMB*1024*1024), 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("dur.interval_ms", dur.TimeMs.Dt, 1.0)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// pushWriteConcern emits how many writes waited for their write concern
+// since the previous poll, how long they waited in total and on average,
+// and how many timed out. A climbing average is w:majority waiting on
+// lagging secondaries.
+func pushWriteConcern(client statsd.Statter, counters *counterStore, host string, gle GetLastError) error {
+	var err error
+
+	waits, waits_ok := counters.delta(host+".write_concern.waits", gle.Wtime.Num)
+	wait_ms, wait_ms_ok := counters.delta(host+".write_concern.wait_ms", gle.Wtime.TotalMillis)
+	if waits_ok && wait_ms_ok {
+		err = client.Inc("write_concern.waits", waits, 1.0)
+		if err != nil {
+			return err
+		}
+
+		err = client.Inc("write_concern.wait_ms", wait_ms, 1.0)
+		if err != nil {
+			return err
+		}
+
+		if waits > 0 {
+			err = client.Gauge("write_concern.avg_wait_ms", wait_ms/waits, 1.0)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	timeouts, ok := counters.delta(host+".write_concern.wtimeouts", gle.Wtimeouts)
+	if ok {
+		err = client.Inc("write_concern.wtimeouts", timeouts, 1.0)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,230 @@
+package mgostatsd
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// Kubernetes discovers one direct target per ready pod matching
+// LabelSelector, in Namespace or in every namespace when it is empty. Pods
+// are relisted every Refresh and are polled on Port.
+type Kubernetes struct {
+	LabelSelector string        "label_selector"
+	Namespace     string        "namespace"
+	Port          int           "port"
+	Refresh       time.Duration "refresh"
+}
+
+func (k Kubernetes) enabled() bool {
+	return len(k.LabelSelector) > 0
+}
+
+type PodMetadata struct {
+	Name      string
+	Namespace string
+}
+
+type PodCondition struct {
+	Type   string
+	Status string
+}
+
+type PodStatus struct {
+	Phase      string
+	PodIP      string
+	Conditions []PodCondition
+}
+
+type Pod struct {
+	Metadata PodMetadata
+	Status   PodStatus
+}
+
+func (p Pod) ready() bool {
+	if p.Status.Phase != "Running" || len(p.Status.PodIP) == 0 {
+		return false
+	}
+	for _, c := range p.Status.Conditions {
+		if c.Type == "Ready" {
+			return c.Status == "True"
+		}
+	}
+	return false
+}
+
+type PodList struct {
+	Items []Pod
+}
+
+// kubernetesClient talks to the API server with the pod's service account,
+// the way in-cluster clients do.
+type kubernetesClient struct {
+	config Kubernetes
+	server string
+	token  *tokenFile
+	http   *http.Client
+}
+
+// tokenFile is the service account token. The kubelet rotates projected
+// tokens while the pod runs, so the file is read again whenever its
+// modification time changes.
+type tokenFile struct {
+	path string
+
+	mu      sync.Mutex
+	token   string
+	modTime time.Time
+}
+
+// get returns the current token. Once a token has been read it is kept
+// while the file can't be, as during a rotation, and an error is only
+// returned before then.
+func (t *tokenFile) get() (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	info, err := os.Stat(t.path)
+	if err == nil && info.ModTime().Equal(t.modTime) && len(t.token) > 0 {
+		return t.token, nil
+	}
+	var data []byte
+	if err == nil {
+		data, err = ioutil.ReadFile(t.path)
+	}
+	if err != nil {
+		if len(t.token) > 0 {
+			logf(LevelWarn, "kubernetes token: %s; keeping the last one read", err)
+			return t.token, nil
+		}
+		return "", err
+	}
+	t.token = strings.TrimSpace(string(data))
+	t.modTime = info.ModTime()
+	return t.token, nil
+}
+
+func newKubernetes(config Kubernetes) (*kubernetesClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if len(host) == 0 || len(port) == 0 {
+		return nil, fmt.Errorf("kubernetes discovery must run inside a cluster: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+
+	token := &tokenFile{path: serviceAccountDir + "/token"}
+	_, err := token.get()
+	if err != nil {
+		return nil, err
+	}
+
+	ca, err := ioutil.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates in %s/ca.crt", serviceAccountDir)
+	}
+
+	return &kubernetesClient{
+		config: config,
+		server: "https://" + net.JoinHostPort(host, port),
+		token:  token,
+		http: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}},
+		},
+	}, nil
+}
+
+func (k *kubernetesClient) pods() ([]Pod, error) {
+	path := "/api/v1/pods"
+	if len(k.config.Namespace) > 0 {
+		path = "/api/v1/namespaces/" + url.PathEscape(k.config.Namespace) + "/pods"
+	}
+	query := url.Values{"labelSelector": {k.config.LabelSelector}}
+
+	var list PodList
+	_, err := k.do("GET", path+"?"+query.Encode(), nil, &list)
+	return list.Items, err
+}
+
+// do sends in, if not nil, as JSON to the API server and decodes a
+// successful response into out, if not nil. It returns the status code
+// even when the request failed with an error status.
+func (k *kubernetesClient) do(method string, path string, in interface{}, out interface{}) (int, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return 0, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	token, err := k.token.get()
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(method, k.server+path, body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := k.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	if out != nil {
+		err = json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode, err
+}
+
+func (k *kubernetesClient) discover() ([]Target, error) {
+	pods, err := k.pods()
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []Target
+	for _, p := range pods {
+		if !p.ready() {
+			continue
+		}
+		targets = append(targets, Target{
+			Addresses: []string{net.JoinHostPort(p.Status.PodIP, strconv.Itoa(k.config.Port))},
+			Direct:    true,
+			Tags: map[string]string{
+				"namespace": p.Metadata.Namespace,
+				"pod":       p.Metadata.Name,
+			},
+		})
+	}
+	return targets, nil
+}
@@ -0,0 +1,57 @@
+package mgostatsd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTokenFileRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "token")
+	token := &tokenFile{path: path}
+
+	write := func(token string, modTime time.Time) {
+		err := ioutil.WriteFile(path, []byte(token+"\n"), 0600)
+		if err == nil {
+			err = os.Chtimes(path, modTime, modTime)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(step string, want string) {
+		got, err := token.get()
+		if err != nil {
+			t.Fatalf("%s: %s", step, err)
+		}
+		if got != want {
+			t.Errorf("%s: token %q, want %q", step, got, want)
+		}
+	}
+
+	_, err = token.get()
+	if err == nil {
+		t.Errorf("no error before the token file exists")
+	}
+
+	start := time.Now().Add(-time.Hour)
+	write("first", start)
+	check("first read", "first")
+
+	// The file is only read again when it changes.
+	write("unchanged", start)
+	check("same modification time", "first")
+
+	write("second", start.Add(time.Minute))
+	check("rotated", "second")
+
+	os.Remove(path)
+	check("removed", "second")
+}
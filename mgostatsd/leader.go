@@ -0,0 +1,191 @@
+package mgostatsd
+
+import (
+	"fmt"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	leaderLockMongo      = "mongo"
+	leaderLockKubernetes = "kubernetes"
+)
+
+// Leader lets several agents watch the same servers for redundancy while
+// only one of them polls and publishes at a time. Lock is where the
+// leadership is held: mongo, a document in Database.Collection on the
+// monitored cluster, or kubernetes, a coordination.k8s.io Lease in
+// Namespace (the agent's own when empty). Either way it is named Name and
+// held as Identity, the host name and pid by default. The leader renews
+// the lock every third of TTL; when it stops, another agent takes over
+// once TTL has passed.
+type Leader struct {
+	Lock       string        "lock"
+	Name       string        "name"
+	Identity   string        "identity"
+	TTL        time.Duration "ttl"
+	Database   string        "database"
+	Collection string        "collection"
+	Namespace  string        "namespace"
+}
+
+func (l Leader) enabled() bool {
+	return len(l.Lock) > 0
+}
+
+type elector interface {
+	// acquire takes or renews the lock, reporting whether it is held.
+	acquire() (bool, error)
+	// release gives up a held lock so another agent need not wait out
+	// the TTL.
+	release() error
+}
+
+func newElector(config Config, targets *targetSet) (elector, error) {
+	if len(config.Leader.Identity) == 0 {
+		host, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		config.Leader.Identity = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+
+	switch config.Leader.Lock {
+	case leaderLockMongo:
+		return &mongoLock{config: config.Leader, mongo: config.Mongo, targets: targets}, nil
+	case leaderLockKubernetes:
+		return newLease(config.Leader)
+	}
+	return nil, nil
+}
+
+// mongoLock holds leadership as the document {_id: Name, holder, expires}.
+// The document is upserted only where this agent already holds it or it
+// has expired; if another agent holds it, the upsert tries to insert a
+// second document with the same _id and fails with a duplicate key error.
+type mongoLock struct {
+	config  Leader
+	mongo   Mongo
+	targets *targetSet
+	session *mgo.Session
+}
+
+// target is where the lock lives: mongo.addresses when they were set, and
+// otherwise the first static or discovered target. Discovered targets may
+// be single members polled directly, so only their addresses are used as
+// a seed and mgo finds the primary.
+func (l *mongoLock) target() (Target, error) {
+	if len(l.mongo.Addresses) > 0 {
+		return Target{Addresses: l.mongo.Addresses}, nil
+	}
+	targets := l.targets.list()
+	if len(targets) == 0 {
+		return Target{}, fmt.Errorf("no target to hold the lock on")
+	}
+	return Target{Addresses: targets[0].Addresses}, nil
+}
+
+func (l *mongoLock) collection() (*mgo.Collection, error) {
+	if l.session == nil {
+		t, err := l.target()
+		if err != nil {
+			return nil, err
+		}
+		l.session, err = dial(l.mongo, t)
+		if err != nil {
+			return nil, err
+		}
+		l.session.SetMode(mgo.Strong, true)
+	}
+	return l.session.DB(l.config.Database).C(l.config.Collection), nil
+}
+
+func (l *mongoLock) acquire() (bool, error) {
+	c, err := l.collection()
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	selector := bson.M{
+		"_id": l.config.Name,
+		"$or": []bson.M{{"holder": l.config.Identity}, {"expires": bson.M{"$lt": now}}},
+	}
+	_, err = c.Upsert(selector, bson.M{"$set": bson.M{"holder": l.config.Identity, "expires": now.Add(l.config.TTL)}})
+	if mgo.IsDup(err) {
+		return false, nil
+	}
+	if err != nil {
+		l.session.Close()
+		l.session = nil
+		return false, err
+	}
+	return true, nil
+}
+
+func (l *mongoLock) release() error {
+	c, err := l.collection()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		l.session.Close()
+		l.session = nil
+	}()
+	return c.Remove(bson.M{"_id": l.config.Name, "holder": l.config.Identity})
+}
+
+// Leader reports whether this agent currently publishes metrics. It is
+// always true without leader election.
+func (a *Agent) Leader() bool {
+	return atomic.LoadInt32(&a.leader) == 1
+}
+
+func (a *Agent) setLeader(leader bool) {
+	var v int32
+	if leader {
+		v = 1
+	}
+	if atomic.SwapInt32(&a.leader, v) == v {
+		return
+	}
+	if leader {
+		// The last samples seen before a standby period would turn the
+		// whole period into one interval's delta.
+		a.config.state.counters.reset()
+		logf(LevelInfo, "leader: acquired %s lock %s", a.config.Leader.Lock, a.config.Leader.Name)
+	} else {
+		logf(LevelWarn, "leader: lost %s lock %s", a.config.Leader.Lock, a.config.Leader.Name)
+	}
+}
+
+// elect keeps trying to take or renew the lock until quit is closed, and
+// then releases it if held. An error renewing counts as losing the lock:
+// another agent may take it over once the TTL passes.
+func (a *Agent) elect(quit <-chan struct{}) {
+	ticker := time.NewTicker(a.config.Leader.TTL / 3)
+	defer ticker.Stop()
+
+	for {
+		leader, err := a.elector.acquire()
+		if err != nil {
+			logf(LevelError, "leader: %s", err)
+		}
+		a.setLeader(leader)
+
+		select {
+		case <-ticker.C:
+		case <-quit:
+			if a.Leader() {
+				err := a.elector.release()
+				if err != nil {
+					logf(LevelError, "leader: releasing: %s", err)
+				}
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package mgostatsd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMongoLockTarget(t *testing.T) {
+	discovered := []Target{
+		{Addresses: []string{"mongo-0.mongo:27017"}, Direct: true},
+		{Addresses: []string{"mongo-1.mongo:27017"}, Direct: true},
+	}
+	tests := []struct {
+		name    string
+		config  func(c *Config)
+		targets []Target
+		want    []string
+	}{
+		{
+			name:    "discovery ignores the default address",
+			config:  func(c *Config) { c.Discovery.Consul.Service = "mongo" },
+			targets: discovered,
+			want:    []string{"mongo-0.mongo:27017"},
+		},
+		{
+			name:    "srv address",
+			config:  func(c *Config) { c.Mongo.Addresses = []string{"mongodb+srv://cluster.example.com"} },
+			targets: discovered,
+			want:    []string{"mongo-0.mongo:27017"},
+		},
+		{
+			name: "static targets ignore the default address",
+			config: func(c *Config) {
+				c.Targets = []StaticTarget{{Addresses: []string{"db1.example.com:27017", "db2.example.com:27017"}}}
+			},
+			targets: []Target{{Addresses: []string{"db1.example.com:27017", "db2.example.com:27017"}}},
+			want:    []string{"db1.example.com:27017", "db2.example.com:27017"},
+		},
+		{
+			name: "explicit addresses hold the lock alongside discovery",
+			config: func(c *Config) {
+				c.Mongo.Addresses = []string{"lock.example.com:27017"}
+				c.Discovery.Consul.Service = "mongo"
+			},
+			targets: discovered,
+			want:    []string{"lock.example.com:27017"},
+		},
+	}
+	for _, tt := range tests {
+		config := DefaultConfig()
+		tt.config(&config)
+		config.normalize()
+
+		targets := &targetSet{}
+		targets.set(tt.targets)
+		l := &mongoLock{config: config.Leader, mongo: config.Mongo, targets: targets}
+		got, err := l.target()
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got.Addresses, tt.want) {
+			t.Errorf("%s: lock on %q, want %q", tt.name, got.Addresses, tt.want)
+		}
+	}
+
+	l := &mongoLock{targets: &targetSet{}}
+	if _, err := l.target(); err == nil {
+		t.Errorf("no targets: want an error")
+	}
+}
@@ -0,0 +1,126 @@
+package mgostatsd
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// The microsecond time format of Kubernetes MicroTime fields.
+const microTime = "2006-01-02T15:04:05.000000Z07:00"
+
+type LeaseMetadata struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type LeaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+}
+
+type Lease struct {
+	APIVersion string        `json:"apiVersion"`
+	Kind       string        `json:"kind"`
+	Metadata   LeaseMetadata `json:"metadata"`
+	Spec       LeaseSpec     `json:"spec"`
+}
+
+// expired reports whether the holder of l has stopped renewing it.
+func (l Lease) expired(now time.Time) bool {
+	if len(l.Spec.HolderIdentity) == 0 {
+		return true
+	}
+	renewed, err := time.Parse(microTime, l.Spec.RenewTime)
+	if err != nil {
+		return true
+	}
+	return now.After(renewed.Add(time.Duration(l.Spec.LeaseDurationSeconds) * time.Second))
+}
+
+// leaseLock holds leadership as a Kubernetes Lease. Updates carry the
+// resourceVersion that was read, so when two agents race for an expired
+// lease the API server rejects all but the first with a conflict.
+type leaseLock struct {
+	config Leader
+	client *kubernetesClient
+}
+
+func newLease(config Leader) (*leaseLock, error) {
+	client, err := newKubernetes(Kubernetes{})
+	if err != nil {
+		return nil, err
+	}
+	if len(config.Namespace) == 0 {
+		namespace, err := ioutil.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return nil, err
+		}
+		config.Namespace = strings.TrimSpace(string(namespace))
+	}
+	return &leaseLock{config: config, client: client}, nil
+}
+
+func (l *leaseLock) path() string {
+	return "/apis/coordination.k8s.io/v1/namespaces/" + url.PathEscape(l.config.Namespace) + "/leases"
+}
+
+func (l *leaseLock) acquire() (bool, error) {
+	now := time.Now()
+	var lease Lease
+	code, err := l.client.do("GET", l.path()+"/"+url.PathEscape(l.config.Name), nil, &lease)
+	if code == http.StatusNotFound {
+		lease = Lease{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata:   LeaseMetadata{Name: l.config.Name, Namespace: l.config.Namespace},
+		}
+		l.hold(&lease, now)
+		code, err = l.client.do("POST", l.path(), lease, nil)
+		if code == http.StatusConflict {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if lease.Spec.HolderIdentity != l.config.Identity && !lease.expired(now) {
+		return false, nil
+	}
+	l.hold(&lease, now)
+	code, err = l.client.do("PUT", l.path()+"/"+url.PathEscape(l.config.Name), lease, nil)
+	if code == http.StatusConflict {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (l *leaseLock) hold(lease *Lease, now time.Time) {
+	if lease.Spec.HolderIdentity != l.config.Identity {
+		lease.Spec.HolderIdentity = l.config.Identity
+		lease.Spec.AcquireTime = now.UTC().Format(microTime)
+	}
+	lease.Spec.LeaseDurationSeconds = int((l.config.TTL + time.Second - 1) / time.Second)
+	lease.Spec.RenewTime = now.UTC().Format(microTime)
+}
+
+func (l *leaseLock) release() error {
+	var lease Lease
+	_, err := l.client.do("GET", l.path()+"/"+url.PathEscape(l.config.Name), nil, &lease)
+	if err != nil {
+		return err
+	}
+	if lease.Spec.HolderIdentity != l.config.Identity {
+		return nil
+	}
+	lease.Spec.HolderIdentity = ""
+	_, err = l.client.do("PUT", l.path()+"/"+url.PathEscape(l.config.Name), lease, nil)
+	return err
+}
@@ -0,0 +1,97 @@
+package mgostatsd
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+var metricTypes = map[string]string{
+	"c":  "counter",
+	"g":  "gauge",
+	"ms": "timer",
+	"s":  "set",
+}
+
+// recordingSender is a statsd.Sender that remembers the name and type of
+// every metric sent through it instead of sending anything.
+type recordingSender struct {
+	mu      sync.Mutex
+	metrics map[string]string
+}
+
+func (s *recordingSender) Send(data []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, line := range strings.Split(string(data), "\n") {
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		fields := strings.Split(line[i+1:], "|")
+		if len(fields) < 2 {
+			continue
+		}
+		s.metrics[line[:i]] = metricTypes[fields[1]]
+	}
+	return len(data), nil
+}
+
+func (s *recordingSender) Close() error {
+	return nil
+}
+
+// ListMetrics polls every target with every enabled collector, like
+// CollectOnce, but returns the name and type of each metric that would
+// have been sent rather than sending it. Names of databases, members and
+// hosts come from the servers, so targets must be reachable. Each
+// collector runs twice so delta counters, which need a previous sample,
+// are listed too. The polls start from and leave behind their own state,
+// so the agent's delta baselines and alerts are untouched.
+func (a *Agent) ListMetrics() ([]string, error) {
+	recorder := &recordingSender{metrics: make(map[string]string)}
+	config := a.config.withState(newState())
+	config.Statsd.sender = recorder
+	config.Statsd.PacketSize = 0
+	if config.Statsd.Rollup.Samples > 0 {
+		// Complete every window at once, so rolled up names are listed.
+		config.Statsd.Rollup.Samples = 1
+	}
+
+	for round := 0; round < 2; round++ {
+		for _, c := range collectors(config) {
+			if c.interval <= 0 {
+				continue
+			}
+			if config.Metrics.ClusterAggregates {
+				config.aggregate = &clusterAggregate{}
+			}
+			for _, t := range a.targets.list() {
+				err := c.poll(config, t)
+				if err != nil {
+					return nil, err
+				}
+				if c.name == a.heartbeat {
+					err = pushUp(config, t, PollStatus{})
+					if err != nil {
+						return nil, err
+					}
+				}
+			}
+			if config.aggregate != nil {
+				err := config.aggregate.push(config)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	list := make([]string, 0, len(recorder.metrics))
+	for name, kind := range recorder.metrics {
+		list = append(list, name+" "+kind)
+	}
+	sort.Strings(list)
+	return list, nil
+}
@@ -0,0 +1,58 @@
+package mgostatsd
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// Level is the severity of a log line. Lines below the current level,
+// set with SetLogLevel, are not printed.
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("Level(%d)", int32(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel returns the level called name, one of debug, info, warn and
+// error.
+func ParseLevel(name string) (Level, error) {
+	for i, n := range levelNames {
+		if strings.EqualFold(n, name) {
+			return Level(i), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", name)
+}
+
+var logLevel = int32(LevelInfo)
+
+// SetLogLevel changes which lines are logged, by every Agent in the process.
+// It is safe to call while an agent is running.
+func SetLogLevel(l Level) {
+	atomic.StoreInt32(&logLevel, int32(l))
+}
+
+// LogLevel returns the current log level.
+func LogLevel() Level {
+	return Level(atomic.LoadInt32(&logLevel))
+}
+
+func logf(l Level, format string, args ...interface{}) {
+	if l < LogLevel() {
+		return
+	}
+	fmt.Printf(strings.ToUpper(l.String())+" "+format+"\n", args...)
+}
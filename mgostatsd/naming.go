@@ -0,0 +1,221 @@
+package mgostatsd
+
+import (
+	"fmt"
+	"github.com/cactus/go-statsd-client/statsd"
+	"strings"
+	"time"
+)
+
+const (
+	namingDefault  = "default"
+	namingGraphite = "graphite"
+	namingDatadog  = "datadog"
+	namingTelegraf = "telegraf"
+)
+
+// A naming preset decides how metric names are laid out, so dashboards
+// built for another collector's conventions keep working.
+type naming struct {
+	// prefix is prepended to every metric of host.
+	prefix func(statsd_config Statsd, host string) string
+	// hostTags sends the host, env and cluster as DogStatsD tags rather
+	// than in the metric path.
+	hostTags bool
+	// rename maps metric names, and name prefixes ending in ".", to the
+	// preset's names. Metrics no entry matches keep their name.
+	rename map[string]string
+}
+
+var namings = map[string]naming{
+	namingDefault:  {prefix: defaultPrefix},
+	namingGraphite: {prefix: graphitePrefix},
+	namingDatadog:  {prefix: mongodbPrefix, hostTags: true, rename: datadogNames},
+	namingTelegraf: {prefix: mongodbPrefix, hostTags: true, rename: telegrafNames},
+}
+
+func namingFor(name string) naming {
+	n, ok := namings[name]
+	if !ok {
+		return namings[namingDefault]
+	}
+	return n
+}
+
+// pathTags appends the values of tags to prefix in key order, when tags
+// are sent as part of the path.
+func pathTags(statsd_config Statsd, prefix string) string {
+	if statsd_config.TagStyle == tagStylePath {
+		for _, k := range sortedTagKeys(statsd_config.Tags) {
+			prefix = fmt.Sprintf("%s.%s", prefix, metricName(statsd_config.Tags[k]))
+		}
+	}
+	return prefix
+}
+
+// defaultPrefix is <env>.<cluster>.[tags.]<host>. Metrics about no
+// single host, such as cluster aggregates, have an empty host and leave
+// it out.
+func defaultPrefix(statsd_config Statsd, host string) string {
+	prefix := statsd_config.Env
+	if len(statsd_config.Cluster) > 0 {
+		prefix = fmt.Sprintf("%s.%s", prefix, statsd_config.Cluster)
+	}
+	prefix = pathTags(statsd_config, prefix)
+	if len(host) == 0 {
+		return prefix
+	}
+	return fmt.Sprintf("%s.%s", prefix, relabel(statsd_config.relabel, host))
+}
+
+// graphitePrefix is mongodb.[tags.]<host>, with the dots and colon of the
+// host replaced so it stays a single path component.
+func graphitePrefix(statsd_config Statsd, host string) string {
+	prefix := pathTags(statsd_config, "mongodb")
+	if len(host) == 0 {
+		return prefix
+	}
+	return fmt.Sprintf("%s.%s", prefix, metricName(relabel(statsd_config.relabel, host)))
+}
+
+func mongodbPrefix(statsd_config Statsd, host string) string {
+	return "mongodb"
+}
+
+// hostTags returns the configured tags plus host, env and cluster tags.
+func hostTags(statsd_config Statsd, host string) map[string]string {
+	tags := make(map[string]string)
+	if len(statsd_config.Env) > 0 {
+		tags["env"] = statsd_config.Env
+	}
+	if len(statsd_config.Cluster) > 0 {
+		tags["cluster"] = statsd_config.Cluster
+	}
+	if len(host) > 0 {
+		tags["host"] = relabel(statsd_config.relabel, host)
+	}
+	return mergeTags(tags, statsd_config.Tags)
+}
+
+// Names of the Datadog MongoDB integration, lowercased as it reports them.
+var datadogNames = map[string]string{
+	"connections.created":           "connections.totalcreated",
+	"ops.inserts":                   "opcounters.insert",
+	"ops.queries":                   "opcounters.query",
+	"ops.updates":                   "opcounters.update",
+	"ops.deletes":                   "opcounters.delete",
+	"ops.getmores":                  "opcounters.getmore",
+	"ops.commands":                  "opcounters.command",
+	"ops_repl.inserts":              "opcountersrepl.insert",
+	"ops_repl.queries":              "opcountersrepl.query",
+	"ops_repl.updates":              "opcountersrepl.update",
+	"ops_repl.deletes":              "opcountersrepl.delete",
+	"ops_repl.getmores":             "opcountersrepl.getmore",
+	"ops_repl.commands":             "opcountersrepl.command",
+	"mem.mapped_with_journal":       "mem.mappedwithjournal",
+	"global_lock.total_time":        "globallock.totaltime",
+	"global_lock.lock_time":         "globallock.locktime",
+	"global_lock.active_readers":    "globallock.activeclients.readers",
+	"global_lock.active_writers":    "globallock.activeclients.writers",
+	"global_lock.active_total":      "globallock.activeclients.total",
+	"global_lock.queued_readers":    "globallock.currentqueue.readers",
+	"global_lock.queued_writers":    "globallock.currentqueue.writers",
+	"global_lock.queued_total":      "globallock.currentqueue.total",
+	"extra.page_faults":             "extra_info.page_faults",
+	"extra.heap_usage":              "extra_info.heap_usage_bytes",
+	"flushing.":                     "backgroundflushing.",
+	"wired_tiger.cache.bytes":       "wiredtiger.cache.bytes_currently_in_cache",
+	"wired_tiger.cache.max_bytes":   "wiredtiger.cache.maximum_bytes_configured",
+	"wired_tiger.cache.dirty_bytes": "wiredtiger.cache.tracked_dirty_bytes_in_cache",
+	"wired_tiger.tickets.":          "wiredtiger.concurrenttransactions.",
+	"repl.my_state":                 "replset.state",
+	"repl.lag.":                     "replset.replicationlag.",
+	"ttl.deleted_documents":         "metrics.ttl.deleteddocuments",
+	"ttl.passes":                    "metrics.ttl.passes",
+	"server_status.":                "serverstatus.",
+}
+
+// Field names of Telegraf's mongodb input.
+var telegrafNames = map[string]string{
+	"connections.current":                 "connections_current",
+	"connections.available":               "connections_available",
+	"connections.created":                 "connections_total_created",
+	"ops.inserts":                         "inserts",
+	"ops.queries":                         "queries",
+	"ops.updates":                         "updates",
+	"ops.deletes":                         "deletes",
+	"ops.getmores":                        "getmores",
+	"ops.commands":                        "commands",
+	"ops_repl.inserts":                    "repl_inserts",
+	"ops_repl.queries":                    "repl_queries",
+	"ops_repl.updates":                    "repl_updates",
+	"ops_repl.deletes":                    "repl_deletes",
+	"ops_repl.getmores":                   "repl_getmores",
+	"ops_repl.commands":                   "repl_commands",
+	"mem.resident":                        "resident_megabytes",
+	"mem.virtual":                         "vsize_megabytes",
+	"mem.mapped":                          "mapped_megabytes",
+	"global_lock.active_readers":          "active_reads",
+	"global_lock.active_writers":          "active_writes",
+	"global_lock.queued_readers":          "queued_reads",
+	"global_lock.queued_writers":          "queued_writes",
+	"extra.page_faults":                   "page_faults",
+	"flushing.flushes":                    "flushes",
+	"wired_tiger.tickets.read.available":  "available_reads",
+	"wired_tiger.tickets.write.available": "available_writes",
+	"wired_tiger.tickets.read.total":      "total_tickets_reads",
+	"wired_tiger.tickets.write.total":     "total_tickets_writes",
+	"wired_tiger.cache.bytes":             "wtcache_current_bytes",
+	"wired_tiger.cache.max_bytes":         "wtcache_max_bytes_configured",
+	"wired_tiger.cache.dirty_bytes":       "wtcache_tracked_dirty_bytes",
+	"repl.lag.":                           "repl_lag.",
+	"ttl.deleted_documents":               "ttl_deletes",
+	"ttl.passes":                          "ttl_passes",
+}
+
+// renamingStatter renames metrics with a preset's rename table before
+// sending them through the wrapped Statter.
+type renamingStatter struct {
+	statsd.Statter
+	rename map[string]string
+}
+
+func (s *renamingStatter) name(stat string) string {
+	if name, ok := s.rename[stat]; ok {
+		return name
+	}
+	from, to := "", ""
+	for k, v := range s.rename {
+		if strings.HasSuffix(k, ".") && strings.HasPrefix(stat, k) && len(k) > len(from) {
+			from, to = k, v
+		}
+	}
+	if len(from) == 0 {
+		return stat
+	}
+	return to + strings.TrimPrefix(stat, from)
+}
+
+func (s *renamingStatter) Inc(stat string, value int64, rate float32) error {
+	return s.Statter.Inc(s.name(stat), value, rate)
+}
+
+func (s *renamingStatter) Dec(stat string, value int64, rate float32) error {
+	return s.Statter.Dec(s.name(stat), value, rate)
+}
+
+func (s *renamingStatter) Gauge(stat string, value int64, rate float32) error {
+	return s.Statter.Gauge(s.name(stat), value, rate)
+}
+
+func (s *renamingStatter) GaugeDelta(stat string, value int64, rate float32) error {
+	return s.Statter.GaugeDelta(s.name(stat), value, rate)
+}
+
+func (s *renamingStatter) Timing(stat string, delta int64, rate float32) error {
+	return s.Statter.Timing(s.name(stat), delta, rate)
+}
+
+func (s *renamingStatter) TimingDuration(stat string, delta time.Duration, rate float32) error {
+	return s.Statter.TimingDuration(s.name(stat), delta, rate)
+}
@@ -0,0 +1,86 @@
+package mgostatsd
+
+import (
+	"fmt"
+	"github.com/cactus/go-statsd-client/statsd"
+)
+
+type LatencyBucket struct {
+	Micros int64 "micros"
+	Count  int64 "count"
+}
+
+// OpLatency is cumulative since server start: Latency is the total time
+// in microseconds spent on Ops operations.
+type OpLatency struct {
+	Latency   int64           "latency"
+	Ops       int64           "ops"
+	Histogram []LatencyBucket "histogram"
+}
+
+type OpLatencies struct {
+	Reads    OpLatency "reads"
+	Writes   OpLatency "writes"
+	Commands OpLatency "commands"
+}
+
+// pushOpLatency emits the average latency over the last interval in
+// microseconds, the number of operations in it and, when the server was
+// asked for them, how many operations fell in each histogram bucket.
+func pushOpLatency(client statsd.Statter, counters *counterStore, host string, name string, op OpLatency) error {
+	var err error
+	key := host + ".op_latencies." + name
+
+	latency, latency_ok := counters.delta(key+".latency", op.Latency)
+	ops, ops_ok := counters.delta(key+".ops", op.Ops)
+	if !latency_ok || !ops_ok {
+		return nil
+	}
+
+	if ops > 0 {
+		err = client.Gauge("op_latencies."+name+".avg_latency", latency/ops, 1.0)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = client.Inc("op_latencies."+name+".ops", ops, 1.0)
+	if err != nil {
+		return err
+	}
+
+	for _, bucket := range op.Histogram {
+		bucket_key := fmt.Sprintf("%s.histogram.%d", key, bucket.Micros)
+		count, ok := counters.delta(bucket_key, bucket.Count)
+		if !ok || count == 0 {
+			continue
+		}
+		err = client.Inc(fmt.Sprintf("op_latencies.%s.histogram.%d", name, bucket.Micros), count, 1.0)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func pushOpLatencies(client statsd.Statter, counters *counterStore, host string, latencies OpLatencies) error {
+	var err error
+
+	err = pushOpLatency(client, counters, host, "reads", latencies.Reads)
+	if err != nil {
+		return err
+	}
+
+	err = pushOpLatency(client, counters, host, "writes", latencies.Writes)
+	if err != nil {
+		return err
+	}
+
+	err = pushOpLatency(client, counters, host, "commands", latencies.Commands)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
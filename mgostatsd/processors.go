@@ -0,0 +1,277 @@
+package mgostatsd
+
+import (
+	"fmt"
+	"github.com/cactus/go-statsd-client/statsd"
+	pathpkg "path"
+	"strings"
+	"time"
+)
+
+const (
+	processRename = "rename"
+	processDrop   = "drop"
+	processScale  = "scale"
+	processClamp  = "clamp"
+	processRatio  = "ratio"
+	processDerive = "derive"
+)
+
+// Processor is one step of the post-processing applied to every metric
+// on its way to statsd, after it is collected and before the naming
+// preset and prefix are applied. Match is a metric name pattern like
+// metrics.paths, in which * matches one component and ** any number.
+//
+// Action is one of:
+//   - rename: replace the components of the name before the first
+//     wildcard of Match with To
+//   - drop: don't send the metric
+//   - scale: multiply the value by Factor
+//   - clamp: limit the value to Min and Max, either of which may be unset
+//   - ratio: once the push is done, send Match / Over * Factor as the
+//     gauge To; Match and Over are metric names without wildcards, and
+//     Factor defaults to 100, giving a percentage
+//   - derive: once the push is done, send the value of Expr as the gauge
+//     To; Expr is arithmetic (+, -, *, / and parentheses) over numbers and
+//     metric names, and Match is unused
+//
+// Steps apply in order, each to the output of the previous ones.
+type Processor struct {
+	Match  string  "match"
+	Action string  "action"
+	To     string  "to"
+	Over   string  "over"
+	Expr   string  "expr"
+	Factor float64 "factor"
+	Min    *int64  "min"
+	Max    *int64  "max"
+}
+
+func (p Processor) validate() []string {
+	var errs []string
+	name := "statsd.processors." + p.Action
+
+	if len(p.Match) == 0 && p.Action != processDerive {
+		errs = append(errs, name+".match must not be empty")
+	}
+	for _, component := range strings.Split(p.Match, ".") {
+		if _, err := pathpkg.Match(component, ""); err != nil {
+			errs = append(errs, fmt.Sprintf("%s.match pattern %q is malformed", name, p.Match))
+			break
+		}
+	}
+
+	switch p.Action {
+	case processRename:
+		if len(p.To) == 0 {
+			errs = append(errs, name+".to must not be empty")
+		}
+	case processDrop:
+	case processScale:
+		if p.Factor == 0 {
+			errs = append(errs, name+".factor must not be zero")
+		}
+	case processClamp:
+		if p.Min == nil && p.Max == nil {
+			errs = append(errs, name+" must set min, max or both")
+		}
+		if p.Min != nil && p.Max != nil && *p.Min > *p.Max {
+			errs = append(errs, name+".min must not be above max")
+		}
+	case processRatio:
+		if len(p.Over) == 0 || len(p.To) == 0 {
+			errs = append(errs, name+" must set over and to")
+		}
+		if strings.Contains(p.Match+p.Over, "*") {
+			errs = append(errs, name+".match and over must not have wildcards")
+		}
+	case processDerive:
+		if len(p.To) == 0 {
+			errs = append(errs, name+".to must not be empty")
+		}
+		if _, _, err := parseExpr(p.Expr); err != nil {
+			errs = append(errs, name+": "+err.Error())
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("statsd.processors action %q must be rename, drop, scale, clamp, ratio or derive", p.Action))
+	}
+	return errs
+}
+
+func (p Processor) matches(stat string) bool {
+	return matchPath(strings.Split(p.Match, "."), strings.Split(stat, "."))
+}
+
+func (p Processor) rename(stat string) string {
+	pattern := strings.Split(p.Match, ".")
+	path := strings.Split(stat, ".")
+	n := 0
+	for n < len(pattern) && !strings.ContainsAny(pattern[n], "*?[") {
+		n++
+	}
+	return strings.Join(append([]string{p.To}, path[n:]...), ".")
+}
+
+// compile returns the expression a ratio or derive step sends, and the
+// metrics it needs.
+func (p Processor) compile() (expr, []string, error) {
+	if p.Action == processRatio {
+		factor := p.Factor
+		if factor == 0 {
+			factor = 100
+		}
+		ratio := exprBinary{op: '/', left: exprMetric(p.Match), right: exprMetric(p.Over)}
+		return exprBinary{op: '*', left: ratio, right: exprNumber(factor)}, []string{p.Match, p.Over}, nil
+	}
+	return parseExpr(p.Expr)
+}
+
+// processingStatter runs every metric sent through it through processors.
+// Values the ratio and derive steps need are remembered as they pass, and
+// the results are sent when the statter is closed.
+type processingStatter struct {
+	statsd.Statter
+	processors []Processor
+	// exprs holds the compiled expression of each ratio and derive step,
+	// inputs the metrics it needs and seen their values.
+	exprs  []expr
+	inputs []map[string]bool
+	seen   []map[string]float64
+}
+
+func newProcessingStatter(client statsd.Statter, processors []Processor) *processingStatter {
+	s := &processingStatter{
+		Statter:    client,
+		processors: processors,
+		exprs:      make([]expr, len(processors)),
+		inputs:     make([]map[string]bool, len(processors)),
+		seen:       make([]map[string]float64, len(processors)),
+	}
+	for i, p := range processors {
+		if p.Action != processRatio && p.Action != processDerive {
+			continue
+		}
+		e, metrics, err := p.compile()
+		if err != nil {
+			continue
+		}
+		s.exprs[i] = e
+		s.inputs[i] = make(map[string]bool)
+		s.seen[i] = make(map[string]float64)
+		for _, m := range metrics {
+			s.inputs[i][m] = true
+		}
+	}
+	return s
+}
+
+// process applies processors from the first'th on to stat and value, and
+// reports whether the metric is still to be sent.
+func (s *processingStatter) process(first int, stat string, value int64) (string, int64, bool) {
+	for i := first; i < len(s.processors); i++ {
+		p := s.processors[i]
+		if s.inputs[i] != nil {
+			if s.inputs[i][stat] {
+				s.seen[i][stat] = float64(value)
+			}
+			continue
+		}
+		if !p.matches(stat) {
+			continue
+		}
+		switch p.Action {
+		case processRename:
+			stat = p.rename(stat)
+		case processDrop:
+			return stat, value, false
+		case processScale:
+			value = int64(float64(value) * p.Factor)
+		case processClamp:
+			if p.Min != nil && value < *p.Min {
+				value = *p.Min
+			}
+			if p.Max != nil && value > *p.Max {
+				value = *p.Max
+			}
+		}
+	}
+	return stat, value, true
+}
+
+func (s *processingStatter) Inc(stat string, value int64, rate float32) error {
+	stat, value, ok := s.process(0, stat, value)
+	if !ok {
+		return nil
+	}
+	return s.Statter.Inc(stat, value, rate)
+}
+
+func (s *processingStatter) Dec(stat string, value int64, rate float32) error {
+	stat, value, ok := s.process(0, stat, value)
+	if !ok {
+		return nil
+	}
+	return s.Statter.Dec(stat, value, rate)
+}
+
+func (s *processingStatter) Gauge(stat string, value int64, rate float32) error {
+	stat, value, ok := s.process(0, stat, value)
+	if !ok {
+		return nil
+	}
+	return s.Statter.Gauge(stat, value, rate)
+}
+
+func (s *processingStatter) GaugeDelta(stat string, value int64, rate float32) error {
+	stat, value, ok := s.process(0, stat, value)
+	if !ok {
+		return nil
+	}
+	return s.Statter.GaugeDelta(stat, value, rate)
+}
+
+func (s *processingStatter) Timing(stat string, delta int64, rate float32) error {
+	stat, delta, ok := s.process(0, stat, delta)
+	if !ok {
+		return nil
+	}
+	return s.Statter.Timing(stat, delta, rate)
+}
+
+func (s *processingStatter) TimingDuration(stat string, delta time.Duration, rate float32) error {
+	stat, ms, ok := s.process(0, stat, int64(delta/time.Millisecond))
+	if !ok {
+		return nil
+	}
+	return s.Statter.TimingDuration(stat, time.Duration(ms)*time.Millisecond, rate)
+}
+
+// Close sends the result of every ratio and derive step whose metrics
+// were all seen, through the steps after its own, and then closes the
+// wrapped Statter.
+func (s *processingStatter) Close() error {
+	var err error
+	for i, p := range s.processors {
+		if s.exprs[i] == nil {
+			continue
+		}
+		result, ok := s.exprs[i].eval(s.seen[i])
+		if !ok {
+			continue
+		}
+		stat, value, ok := s.process(i+1, p.To, int64(result))
+		if !ok {
+			continue
+		}
+		gerr := s.Statter.Gauge(stat, value, 1.0)
+		if err == nil {
+			err = gerr
+		}
+	}
+
+	cerr := s.Statter.Close()
+	if err == nil {
+		err = cerr
+	}
+	return err
+}
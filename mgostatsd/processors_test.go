@@ -0,0 +1,97 @@
+package mgostatsd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProcessingStatterOrder(t *testing.T) {
+	five := int64(5)
+	tests := []struct {
+		name       string
+		processors []Processor
+		gauges     [][2]interface{}
+		want       []string
+	}{
+		{
+			name: "rename before ratio feeds it the new names",
+			processors: []Processor{
+				{Match: "tickets.*", Action: processRename, To: "wt.tickets"},
+				{Match: "wt.tickets.out", Over: "wt.tickets.total", Action: processRatio, To: "wt.tickets.used_percent"},
+			},
+			gauges: [][2]interface{}{{"tickets.out", int64(32)}, {"tickets.total", int64(128)}},
+			want:   []string{"wt.tickets.out:32|g", "wt.tickets.total:128|g", "wt.tickets.used_percent:25|g"},
+		},
+		{
+			name: "ratio before rename sees the old names and is renamed itself",
+			processors: []Processor{
+				{Match: "tickets.out", Over: "tickets.total", Action: processRatio, To: "tickets.used_percent"},
+				{Match: "tickets.*", Action: processRename, To: "wt.tickets"},
+			},
+			gauges: [][2]interface{}{{"tickets.out", int64(32)}, {"tickets.total", int64(128)}},
+			want:   []string{"wt.tickets.out:32|g", "wt.tickets.total:128|g", "wt.tickets.used_percent:25|g"},
+		},
+		{
+			name: "rename before ratio hides the old names from it",
+			processors: []Processor{
+				{Match: "tickets.*", Action: processRename, To: "wt.tickets"},
+				{Match: "tickets.out", Over: "tickets.total", Action: processRatio, To: "tickets.used_percent"},
+			},
+			gauges: [][2]interface{}{{"tickets.out", int64(32)}, {"tickets.total", int64(128)}},
+			want:   []string{"wt.tickets.out:32|g", "wt.tickets.total:128|g"},
+		},
+		{
+			name: "derive feeds a later derive",
+			processors: []Processor{
+				{Action: processDerive, To: "conn.total", Expr: "conn.current + conn.available"},
+				{Action: processDerive, To: "conn.used_percent", Expr: "conn.current * 100 / conn.total"},
+			},
+			gauges: [][2]interface{}{{"conn.current", int64(30)}, {"conn.available", int64(70)}},
+			want:   []string{"conn.current:30|g", "conn.available:70|g", "conn.total:100|g", "conn.used_percent:30|g"},
+		},
+		{
+			name: "derive missing an input is skipped",
+			processors: []Processor{
+				{Action: processDerive, To: "conn.total", Expr: "conn.current + conn.available"},
+			},
+			gauges: [][2]interface{}{{"conn.current", int64(30)}},
+			want:   []string{"conn.current:30|g"},
+		},
+		{
+			name: "steps after a derive apply to its result",
+			processors: []Processor{
+				{Action: processDerive, To: "a.double", Expr: "a.value * 2"},
+				{Match: "a.*", Action: processClamp, Max: &five},
+				{Match: "a.value", Action: processDrop},
+			},
+			gauges: [][2]interface{}{{"a.value", int64(4)}},
+			want:   []string{"a.double:5|g"},
+		},
+		{
+			name: "scale then clamp",
+			processors: []Processor{
+				{Match: "mem.*", Action: processScale, Factor: 1.5},
+				{Match: "mem.*", Action: processClamp, Max: &five},
+			},
+			gauges: [][2]interface{}{{"mem.resident", int64(2)}, {"mem.virtual", int64(4)}},
+			want:   []string{"mem.resident:3|g", "mem.virtual:5|g"},
+		},
+	}
+	for _, tt := range tests {
+		fake := &fakeStatter{}
+		s := newProcessingStatter(fake, tt.processors)
+		for _, g := range tt.gauges {
+			err := s.Gauge(g[0].(string), g[1].(int64), 1.0)
+			if err != nil {
+				t.Fatalf("%s: Gauge: %s", tt.name, err)
+			}
+		}
+		err := s.Close()
+		if err != nil {
+			t.Fatalf("%s: Close: %s", tt.name, err)
+		}
+		if !reflect.DeepEqual(fake.lines, tt.want) {
+			t.Errorf("%s: sent %q, want %q", tt.name, fake.lines, tt.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package mgostatsd
+
+import (
+	"github.com/cactus/go-statsd-client/statsd"
+	"strings"
+	"time"
+)
+
+// pushErrors collects the error of every metric family that failed to
+// push, so one failing family doesn't keep the others from being sent.
+type pushErrors []string
+
+func (e *pushErrors) add(family string, err error) {
+	if err != nil {
+		*e = append(*e, family+": "+err.Error())
+	}
+}
+
+func (e pushErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e pushErrors) Error() string {
+	return "push failed for " + strings.Join(e, "; ")
+}
+
+// countingStatter counts the metrics sent through the wrapped Statter and
+// how many of them failed.
+type countingStatter struct {
+	statsd.Statter
+	sent   int64
+	failed int64
+}
+
+func (s *countingStatter) count(err error) error {
+	if err != nil {
+		s.failed++
+	} else {
+		s.sent++
+	}
+	return err
+}
+
+func (s *countingStatter) Inc(stat string, value int64, rate float32) error {
+	return s.count(s.Statter.Inc(stat, value, rate))
+}
+
+func (s *countingStatter) Dec(stat string, value int64, rate float32) error {
+	return s.count(s.Statter.Dec(stat, value, rate))
+}
+
+func (s *countingStatter) Gauge(stat string, value int64, rate float32) error {
+	return s.count(s.Statter.Gauge(stat, value, rate))
+}
+
+func (s *countingStatter) GaugeDelta(stat string, value int64, rate float32) error {
+	return s.count(s.Statter.GaugeDelta(stat, value, rate))
+}
+
+func (s *countingStatter) Timing(stat string, delta int64, rate float32) error {
+	return s.count(s.Statter.Timing(stat, delta, rate))
+}
+
+func (s *countingStatter) TimingDuration(stat string, delta time.Duration, rate float32) error {
+	return s.count(s.Statter.TimingDuration(stat, delta, rate))
+}
+
+// pushCounts reports how many metrics a push sent and how many failed, as
+// agent.push.sent and agent.push.failed.
+func pushCounts(client statsd.Statter, counted *countingStatter) error {
+	var err error
+
+	err = client.Gauge("agent.push.sent", counted.sent, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("agent.push.failed", counted.failed, 1.0)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
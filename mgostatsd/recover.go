@@ -0,0 +1,47 @@
+package mgostatsd
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// recoverPoll runs c against t, turning a panic, such as one on a reply of
+// an unexpected shape, into an error that fails this poll alone instead of
+// crashing the agent.
+func (a *Agent) recoverPoll(c collector, config Config, t Target) (err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		atomic.AddInt64(&a.panics, 1)
+		logf(LevelError, "%s %s: panic: %v\n%s", c.name, t, r, debug.Stack())
+		err = fmt.Errorf("panic: %v", r)
+
+		perr := pushPanic(config, t, c.name)
+		if perr != nil {
+			logf(LevelError, "%s panics: %s", t, perr)
+		}
+	}()
+	return c.poll(config, t)
+}
+
+// pushPanic counts a recovered panic as agent.panics.<collector>, under
+// the target's label: the poll may have panicked before the server's host
+// name was known.
+func pushPanic(config Config, t Target, collector string) (err error) {
+	config = config.forTarget(t)
+	client, err := newStatter(config.Statsd, t.label())
+	if err != nil {
+		return err
+	}
+	defer closeStatter(client, &err)
+
+	return client.Inc("agent.panics."+collector, 1, 1.0)
+}
+
+// Panics returns how many polls have panicked since the agent started.
+func (a *Agent) Panics() int64 {
+	return atomic.LoadInt64(&a.panics)
+}
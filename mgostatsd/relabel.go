@@ -0,0 +1,47 @@
+package mgostatsd
+
+import (
+	"regexp"
+)
+
+// Relabel renames hosts before they are used in metric names. Match is a
+// regular expression that must match the whole host name as reported by
+// the server; Replace is the new name, in which $1 or ${name} expand to
+// capture groups.
+type Relabel struct {
+	Match   string "match"
+	Replace string "replace"
+}
+
+func (r Relabel) compile() (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + r.Match + ")$")
+}
+
+type relabelRule struct {
+	re      *regexp.Regexp
+	replace string
+}
+
+// compileRelabel compiles rules once, rather than on every push.
+func compileRelabel(rules []Relabel) ([]relabelRule, error) {
+	compiled := make([]relabelRule, len(rules))
+	for i, r := range rules {
+		re, err := r.compile()
+		if err != nil {
+			return nil, err
+		}
+		compiled[i] = relabelRule{re: re, replace: r.Replace}
+	}
+	return compiled, nil
+}
+
+// relabel returns host rewritten by the first rule that matches it, or
+// host itself if none does.
+func relabel(rules []relabelRule, host string) string {
+	for _, r := range rules {
+		if m := r.re.FindStringSubmatchIndex(host); m != nil {
+			return string(r.re.ExpandString(nil, r.replace, host, m))
+		}
+	}
+	return host
+}
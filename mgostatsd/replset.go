@@ -0,0 +1,123 @@
+package mgostatsd
+
+import (
+	"github.com/cactus/go-statsd-client/statsd"
+	"gopkg.in/mgo.v2"
+	"time"
+)
+
+const replSetPrimary = 1
+
+type ReplSetMember struct {
+	Name       string    "name"
+	Health     int64     "health"
+	State      int64     "state"
+	StateStr   string    "stateStr"
+	OptimeDate time.Time "optimeDate"
+	Self       bool      "self"
+}
+
+type ReplSetStatus struct {
+	Set     string          "set"
+	MyState int64           "myState"
+	Members []ReplSetMember "members"
+}
+
+func replSetStatus(session *mgo.Session) (ReplSetStatus, error) {
+	var s ReplSetStatus
+	err := session.Run("replSetGetStatus", &s)
+	return s, err
+}
+
+type memberLag struct {
+	name string
+	lag  time.Duration
+}
+
+// lags returns how far each member is behind the primary. Lag is only
+// meaningful relative to a primary, so there are none without one, and
+// members without an optime (arbiters) are skipped.
+func (s ReplSetStatus) lags() []memberLag {
+	var primary *ReplSetMember
+	for i, member := range s.Members {
+		if member.State == replSetPrimary {
+			primary = &s.Members[i]
+		}
+	}
+	if primary == nil {
+		return nil
+	}
+
+	var lags []memberLag
+	for _, member := range s.Members {
+		if member.OptimeDate.IsZero() {
+			continue
+		}
+		lags = append(lags, memberLag{member.Name, primary.OptimeDate.Sub(member.OptimeDate)})
+	}
+	return lags
+}
+
+func pushReplSet(client statsd.Statter, status ReplSetStatus) error {
+	var err error
+
+	err = client.Gauge("repl.my_state", status.MyState, 1.0)
+	if err != nil {
+		return err
+	}
+
+	var healthy int64
+	for _, member := range status.Members {
+		healthy += member.Health
+	}
+
+	err = client.Gauge("repl.members", int64(len(status.Members)), 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("repl.members_healthy", healthy, 1.0)
+	if err != nil {
+		return err
+	}
+
+	for _, member := range status.lags() {
+		err = client.Gauge("repl.lag."+metricName(member.name), int64(member.lag/time.Millisecond), 1.0)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func collectReplSet(session *mgo.Session, config Config) (err error) {
+	host, err := hostName(session)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	status, err := replSetStatus(session)
+	if err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+
+	if config.aggregate != nil {
+		config.aggregate.addReplSet(status)
+	}
+
+	client, err := newStatter(config.Statsd, host)
+	if err != nil {
+		return err
+	}
+	defer closeStatter(client, &err)
+
+	err = pushCollectTime(client, "repl_set", elapsed)
+	if err != nil {
+		return err
+	}
+
+	return pushReplSet(client, status)
+}
@@ -0,0 +1,56 @@
+package mgostatsd
+
+import (
+	"github.com/cactus/go-statsd-client/statsd"
+	"sync"
+)
+
+type processSample struct {
+	pid    int64
+	uptime int64
+}
+
+// processStore remembers the pid and uptime each host last reported, to
+// notice restarts without reading the server log.
+type processStore struct {
+	mu   sync.Mutex
+	last map[string]processSample
+}
+
+// restarted records the process of host and reports whether it restarted
+// since the last call: its uptime went backwards or its pid changed.
+func (p *processStore) restarted(host string, pid int64, uptime int64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	last, ok := p.last[host]
+	p.last[host] = processSample{pid, uptime}
+	return ok && (uptime < last.uptime || pid != last.pid)
+}
+
+// pushServer emits the uptime in seconds, a server.restarts counter when
+// the server restarted since the last poll, and server.version.<version>
+// set to 1 so version skew across a fleet shows up next to everything else.
+func pushServer(client statsd.Statter, processes *processStore, status ServerStatus, units Units) error {
+	var err error
+
+	err = units.gaugeSeconds(client, "server.uptime", status.Uptime)
+	if err != nil {
+		return err
+	}
+
+	if processes.restarted(status.Host, status.Pid, status.Uptime) {
+		logf(LevelWarn, "%s restarted, up %ds", status.Host, status.Uptime)
+		err = client.Inc("server.restarts", 1, 1.0)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = client.Gauge("server.version."+metricName(status.Version), 1, 1.0)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
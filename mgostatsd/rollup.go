@@ -0,0 +1,130 @@
+package mgostatsd
+
+import (
+	"fmt"
+	"github.com/cactus/go-statsd-client/statsd"
+	pathpkg "path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Rollup summarises gauges sampled at a short interval instead of sending
+// every sample: the gauges matching one of the Match patterns are kept
+// for Samples polls, and then sent as <name>.min, .max, .avg and .p95 of
+// that window. Spikes survive a statsd or Graphite resolution coarser than
+// the poll interval, at a fraction of the traffic. Patterns are written
+// like metrics.paths, against the names after processing; counters and
+// timers are never rolled up, since statsd already aggregates them. A zero
+// Samples disables rollups.
+type Rollup struct {
+	Samples int      "samples"
+	Match   []string "match"
+}
+
+func (r Rollup) validate() []string {
+	var errs []string
+	if r.Samples < 0 {
+		errs = append(errs, "statsd.rollup.samples must not be negative")
+	}
+	if r.Samples > 0 && len(r.Match) == 0 {
+		errs = append(errs, "statsd.rollup.match must not be empty")
+	}
+	for _, pattern := range r.Match {
+		for _, component := range strings.Split(pattern, ".") {
+			if _, err := pathpkg.Match(component, ""); err != nil {
+				errs = append(errs, fmt.Sprintf("statsd.rollup.match pattern %q is malformed", pattern))
+				break
+			}
+		}
+	}
+	return errs
+}
+
+func (r Rollup) matches(stat string) bool {
+	path := strings.Split(stat, ".")
+	for _, pattern := range r.Match {
+		if matchPath(strings.Split(pattern, "."), path) {
+			return true
+		}
+	}
+	return false
+}
+
+// windowStore holds the samples of every rolled up gauge until its window
+// is full. Keys include the metric prefix so hosts don't share windows.
+type windowStore struct {
+	mu      sync.Mutex
+	samples map[string][]int64
+}
+
+// add records value under key and, once size samples are in, returns them
+// and starts a new window.
+func (w *windowStore) add(key string, value int64, size int) ([]int64, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	samples := append(w.samples[key], value)
+	if len(samples) < size {
+		w.samples[key] = samples
+		return nil, false
+	}
+	delete(w.samples, key)
+	return samples, true
+}
+
+// rollupStatter holds back the gauges its Rollup matches, and sends the
+// summary of each in place of the sample that completes its window.
+type rollupStatter struct {
+	statsd.Statter
+	rollup  Rollup
+	windows *windowStore
+	prefix  string
+}
+
+func (s *rollupStatter) Gauge(stat string, value int64, rate float32) error {
+	if !s.rollup.matches(stat) {
+		return s.Statter.Gauge(stat, value, rate)
+	}
+	samples, full := s.windows.add(s.prefix+stat, value, s.rollup.Samples)
+	if !full {
+		return nil
+	}
+	return pushWindow(s.Statter, stat, samples)
+}
+
+// pushWindow sends the min, max, average and 95th percentile (nearest
+// rank) of samples.
+func pushWindow(client statsd.Statter, stat string, samples []int64) error {
+	var err error
+	sorted := append([]int64(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var sum int64
+	for _, v := range sorted {
+		sum += v
+	}
+	p95 := sorted[(len(sorted)*95+99)/100-1]
+
+	err = client.Gauge(stat+".min", sorted[0], 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge(stat+".max", sorted[len(sorted)-1], 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge(stat+".avg", sum/int64(len(sorted)), 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge(stat+".p95", p95, 1.0)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package mgostatsd
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// sequence returns n samples from n down to 1, so pushWindow has to sort
+// them.
+func sequence(n int) []int64 {
+	samples := make([]int64, n)
+	for i := range samples {
+		samples[i] = int64(n - i)
+	}
+	return samples
+}
+
+func TestPushWindow(t *testing.T) {
+	tests := []struct {
+		samples            []int64
+		min, max, avg, p95 int64
+	}{
+		{[]int64{7}, 7, 7, 7, 7},
+		{[]int64{1, 2}, 1, 2, 1, 2},
+		{[]int64{5, 1, 3}, 1, 5, 3, 5},
+		{sequence(10), 1, 10, 5, 10},
+		{sequence(20), 1, 20, 10, 19},
+		{sequence(100), 1, 100, 50, 95},
+		{append(sequence(99), 1000), 1, 1000, 59, 95},
+	}
+	for _, tt := range tests {
+		fake := &fakeStatter{}
+		err := pushWindow(fake, "ops", tt.samples)
+		if err != nil {
+			t.Fatalf("pushWindow(%v): %s", tt.samples, err)
+		}
+		want := []string{
+			"ops.min:" + strconv.FormatInt(tt.min, 10) + "|g",
+			"ops.max:" + strconv.FormatInt(tt.max, 10) + "|g",
+			"ops.avg:" + strconv.FormatInt(tt.avg, 10) + "|g",
+			"ops.p95:" + strconv.FormatInt(tt.p95, 10) + "|g",
+		}
+		if !reflect.DeepEqual(fake.lines, want) {
+			t.Errorf("pushWindow(%v) sent %q, want %q", tt.samples, fake.lines, want)
+		}
+	}
+}
+
+func TestRollupStatterWindows(t *testing.T) {
+	fake := &fakeStatter{}
+	s := &rollupStatter{
+		Statter: fake,
+		rollup:  Rollup{Samples: 3, Match: []string{"ops.*"}},
+		windows: &windowStore{samples: make(map[string][]int64)},
+		prefix:  "env/db1/",
+	}
+	for _, v := range []int64{3, 1, 2, 9} {
+		s.Gauge("ops.queries", v, 1.0)
+		s.Gauge("mem.resident", v, 1.0)
+	}
+	want := []string{
+		"mem.resident:3|g",
+		"mem.resident:1|g",
+		"ops.queries.min:1|g",
+		"ops.queries.max:3|g",
+		"ops.queries.avg:2|g",
+		"ops.queries.p95:3|g",
+		"mem.resident:2|g",
+		"mem.resident:9|g",
+	}
+	if !reflect.DeepEqual(fake.lines, want) {
+		t.Errorf("sent %q, want %q", fake.lines, want)
+	}
+}
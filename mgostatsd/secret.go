@@ -0,0 +1,74 @@
+package mgostatsd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Secret names where a credential is fetched from at startup so it never
+// has to appear in the config itself. At most one source may be set.
+type Secret struct {
+	File    string "file"
+	Env     string "env"
+	Command string "command"
+}
+
+func (s Secret) sources() int {
+	n := 0
+	for _, source := range []string{s.File, s.Env, s.Command} {
+		if len(source) > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// resolve returns the secret with any trailing newline removed. Commands
+// run through sh -c and must print the secret on stdout.
+func (s Secret) resolve() (string, error) {
+	var value []byte
+	var err error
+
+	switch {
+	case len(s.File) > 0:
+		value, err = ioutil.ReadFile(s.File)
+	case len(s.Env) > 0:
+		v, ok := os.LookupEnv(s.Env)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", s.Env)
+		}
+		value = []byte(v)
+	case len(s.Command) > 0:
+		cmd := exec.Command("sh", "-c", s.Command)
+		cmd.Stderr = os.Stderr
+		value, err = cmd.Output()
+		if err != nil {
+			err = fmt.Errorf("secret command %q: %s", s.Command, err)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(value), "\r\n"), nil
+}
+
+func resolveSecrets(cfg *Config) error {
+	if cfg.Mongo.PassFrom.sources() > 0 {
+		pass, err := cfg.Mongo.PassFrom.resolve()
+		if err != nil {
+			return fmt.Errorf("mongo.pass_from: %s", err)
+		}
+		cfg.Mongo.Pass = pass
+	}
+	if cfg.Discovery.Consul.TokenFrom.sources() > 0 {
+		token, err := cfg.Discovery.Consul.TokenFrom.resolve()
+		if err != nil {
+			return fmt.Errorf("discovery.consul.token_from: %s", err)
+		}
+		cfg.Discovery.Consul.Token = token
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package mgostatsd
+
+import (
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+)
+
+// serverStatus sections that built-in metrics read.
+var defaultSections = []string{
+	"asserts",
+	"backgroundFlushing",
+	"connections",
+	"dur",
+	"extra_info",
+	"flowControl",
+	"freeMonitoring",
+	"globalLock",
+	"mem",
+	"metrics",
+	"opLatencies",
+	"opcounters",
+	"opcountersRepl",
+	"security",
+	"storageEngine",
+	"wiredTiger",
+}
+
+// serverStatus sections that no built-in metric reads. Some are large or
+// costly to build (tcmalloc, locks), which adds up at short intervals.
+var optionalSections = []string{
+	"electionMetrics",
+	"locks",
+	"logicalSessionRecordCache",
+	"network",
+	"repl",
+	"shardingStatistics",
+	"tcmalloc",
+	"transactions",
+}
+
+// referencedSections returns the top-level serverStatus sections that
+// metric paths and alerts read. all is true when a pattern starts with a
+// wildcard and may read any section.
+func referencedSections(config Config) (sections map[string]bool, all bool) {
+	paths := config.Metrics.patterns()
+	for _, a := range config.Alerts {
+		r, err := parseRule(a.Rule)
+		if err == nil {
+			paths = append(paths, r.path)
+		}
+	}
+
+	sections = make(map[string]bool)
+	for _, p := range paths {
+		section := strings.SplitN(p, ".", 2)[0]
+		if strings.Contains(section, "*") {
+			return nil, true
+		}
+		sections[section] = true
+	}
+	return sections, false
+}
+
+// serverStatusCommand asks only for what the configuration uses: optional
+// sections are turned off unless a metric path or alert reads them.
+func serverStatusCommand(config Config) bson.D {
+	cmd := bson.D{{Name: "serverStatus", Value: 1}}
+
+	sections, all := referencedSections(config)
+	if !all {
+		for _, section := range optionalSections {
+			if !sections[section] {
+				cmd = append(cmd, bson.DocElem{Name: section, Value: 0})
+			}
+		}
+	}
+
+	if config.Metrics.LatencyHistograms {
+		cmd = append(cmd, bson.DocElem{Name: "opLatencies", Value: bson.M{"histograms": true}})
+	}
+	return cmd
+}
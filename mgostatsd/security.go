@@ -0,0 +1,123 @@
+package mgostatsd
+
+import (
+	"github.com/cactus/go-statsd-client/statsd"
+	"sort"
+)
+
+// Asserts counts the assertions raised since the server started. User
+// assertions are errors a client caused, such as failed authentication or
+// duplicate keys.
+type Asserts struct {
+	Regular   int64 "regular"
+	Warning   int64 "warning"
+	Msg       int64 "msg"
+	User      int64 "user"
+	Rollovers int64 "rollovers"
+}
+
+type AuthCounts struct {
+	Received   int64 "received"
+	Successful int64 "successful"
+}
+
+type AuthMechanism struct {
+	Authenticate AuthCounts "authenticate"
+}
+
+// Authentication counters per mechanism appeared in MongoDB 4.4, and are
+// empty before.
+type Authentication struct {
+	Mechanisms map[string]AuthMechanism "mechanisms"
+}
+
+// Security is the "security" section of serverStatus.
+type Security struct {
+	Authentication Authentication "authentication"
+}
+
+// pushAsserts emits how many assertions of each kind the server raised
+// since the previous poll.
+func pushAsserts(client statsd.Statter, counters *counterStore, host string, asserts Asserts) error {
+	var err error
+
+	for _, a := range []struct {
+		name  string
+		value int64
+	}{
+		{"regular", asserts.Regular},
+		{"warning", asserts.Warning},
+		{"msg", asserts.Msg},
+		{"user", asserts.User},
+		{"rollovers", asserts.Rollovers},
+	} {
+		delta, ok := counters.delta(host+".asserts."+a.name, a.value)
+		if !ok {
+			continue
+		}
+		err = client.Inc("asserts."+a.name, delta, 1.0)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pushAuthentication emits the authentication attempts and failures since
+// the previous poll, per mechanism as security.auth.<mechanism>.* and in
+// total as security.auth.*, so brute-force attempts and clients with
+// stale credentials show up.
+func pushAuthentication(client statsd.Statter, counters *counterStore, host string, security Security) error {
+	var err error
+	mechanisms := security.Authentication.Mechanisms
+	if len(mechanisms) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(mechanisms))
+	for name := range mechanisms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var attempts, failures int64
+	complete := true
+	for _, name := range names {
+		counts := mechanisms[name].Authenticate
+		key := host + ".security.auth." + name
+		received, received_ok := counters.delta(key+".attempts", counts.Received)
+		failed, failed_ok := counters.delta(key+".failures", counts.Received-counts.Successful)
+		if !received_ok || !failed_ok {
+			complete = false
+			continue
+		}
+		attempts += received
+		failures += failed
+
+		err = client.Inc("security.auth."+metricName(name)+".attempts", received, 1.0)
+		if err != nil {
+			return err
+		}
+
+		err = client.Inc("security.auth."+metricName(name)+".failures", failed, 1.0)
+		if err != nil {
+			return err
+		}
+	}
+	if !complete {
+		return nil
+	}
+
+	err = client.Inc("security.auth.attempts", attempts, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Inc("security.auth.failures", failures, 1.0)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
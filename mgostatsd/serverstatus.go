@@ -0,0 +1,495 @@
+package mgostatsd
+
+import (
+	"crypto/x509"
+	"github.com/cactus/go-statsd-client/statsd"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"time"
+)
+
+type Connections struct {
+	Current      int64 "current"
+	Available    int64 "available"
+	TotalCreated int64 "totalCreated"
+}
+
+type Mem struct {
+	Resident          int64 "resident"
+	Virtual           int64 "virtual"
+	Mapped            int64 "mapped"
+	MappedWithJournal int64 "mappedWithJournal"
+}
+
+type RWT struct {
+	Readers int64 "readers"
+	Writers int64 "writers"
+	Total   int64 "total"
+}
+
+type GlobalLock struct {
+	TotalTime     int64 "totalTime"
+	LockTime      int64 "lockTime"
+	CurrentQueue  RWT   "currentQueue"
+	ActiveClients RWT   "activeClients"
+}
+
+type Opcounters struct {
+	Insert  int64 "insert"
+	Query   int64 "query"
+	Update  int64 "update"
+	Delete  int64 "delete"
+	GetMore int64 "getmore"
+	Command int64 "command"
+}
+
+type ExtraInfo struct {
+	PageFaults       int64 "page_faults"
+	HeapUsageInBytes int64 "heap_usage_bytes"
+}
+
+type BackgroundFlushing struct {
+	Flushes   int64 "flushes"
+	TotalMs   int64 "total_ms"
+	AverageMs int64 "average_ms"
+	LastMs    int64 "last_ms"
+}
+
+type StorageEngine struct {
+	Name string "name"
+}
+
+const (
+	engineMMAPv1     = "mmapv1"
+	engineWiredTiger = "wiredTiger"
+)
+
+type ServerStatus struct {
+	Host                 string             "host"
+	Version              string             "version"
+	Process              string             "process"
+	Pid                  int64              "pid"
+	Uptime               int64              "uptime"
+	UptimeInMillis       int64              "uptimeMillis"
+	UptimeEstimate       int64              "uptimeEstimate"
+	LocalTime            time.Time          "localTime"
+	Connections          Connections        "connections"
+	ExtraInfo            ExtraInfo          "extra_info"
+	Mem                  Mem                "mem"
+	GlobalLocks          GlobalLock         "globalLock"
+	Opcounters           Opcounters         "opcounters"
+	OpcountersReplicaSet Opcounters         "opcountersRepl"
+	StorageEngine        StorageEngine      "storageEngine"
+	WiredTiger           WiredTiger         "wiredTiger"
+	OpLatencies          OpLatencies        "opLatencies"
+	BackgroundFlushing   BackgroundFlushing "backgroundFlushing"
+	Dur                  Dur                "dur"
+	Metrics              ServerMetrics      "metrics"
+	FreeMonitoring       FreeMonitoring     "freeMonitoring"
+	Asserts              Asserts            "asserts"
+	FlowControl          FlowControl        "flowControl"
+	Security             Security           "security"
+
+	// raw is the undecoded reply, kept for generic path extraction.
+	raw bson.Raw
+	// sampled is when, by the agent's clock, the server most likely
+	// produced the reply: halfway through the round-trip.
+	sampled time.Time
+}
+
+// engine returns the storage engine the server runs. Servers older than
+// 3.0 do not report one, and MMAPv1 was their only engine.
+func (s ServerStatus) engine() string {
+	if len(s.StorageEngine.Name) == 0 {
+		return engineMMAPv1
+	}
+	return s.StorageEngine.Name
+}
+
+// layout returns which version-dependent fields the server reports.
+func (s ServerStatus) layout() layout {
+	return layoutFor(parseVersion(s.Version))
+}
+
+func dial(mongo_config Mongo, t Target) (*mgo.Session, error) {
+	info := mgo.DialInfo{
+		Addrs:   t.Addresses,
+		Direct:  t.Direct,
+		Timeout: time.Second * 30,
+	}
+
+	var cert *x509.Certificate
+	if mongo_config.TLS.Enabled {
+		var err error
+		cert, err = dialTLS(&info, mongo_config.TLS)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	session, err := mgo.DialWithInfo(&info)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(mongo_config.User) > 0 || mongo_config.AuthMechanism == authX509 {
+		cred := mgo.Credential{
+			Username:  mongo_config.User,
+			Password:  mongo_config.Pass,
+			Source:    mongo_config.AuthSource,
+			Mechanism: mongo_config.AuthMechanism,
+		}
+		if mongo_config.AuthMechanism == authX509 {
+			cred.Source = "$external"
+		}
+		if mongo_config.AuthMechanism == authX509 && len(cred.Username) == 0 && cert != nil {
+			// mgo sends the user as given, and servers before 3.4
+			// reject an empty one.
+			cred.Username, err = subjectDN(cert)
+			if err != nil {
+				session.Close()
+				return nil, err
+			}
+		}
+		err = session.Login(&cred)
+		if err != nil {
+			session.Close()
+			return nil, err
+		}
+	}
+
+	// Optional. Switch the session to a monotonic behavior.
+	session.SetMode(mgo.Monotonic, true)
+
+	return session, nil
+}
+
+func serverStatus(session *mgo.Session, config Config) (ServerStatus, error) {
+	var s ServerStatus
+	err := session.Run(serverStatusCommand(config), &s.raw)
+	if err != nil {
+		return s, err
+	}
+	err = s.raw.Unmarshal(&s)
+	return s, err
+}
+
+func pushConnections(client statsd.Statter, prefix string, connections Connections) error {
+	var err error
+	// Connections
+	err = client.Gauge(prefix+".current", int64(connections.Current), 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge(prefix+".available", int64(connections.Available), 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge(prefix+".created", int64(connections.TotalCreated), 1.0)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func pushOpcounters(client statsd.Statter, counters *counterStore, mode string, host string, prefix string, opscounters Opcounters) error {
+	var err error
+
+	err = pushCounter(client, counters, mode, host, prefix+".inserts", opscounters.Insert)
+	if err != nil {
+		return err
+	}
+
+	err = pushCounter(client, counters, mode, host, prefix+".queries", opscounters.Query)
+	if err != nil {
+		return err
+	}
+
+	err = pushCounter(client, counters, mode, host, prefix+".updates", opscounters.Update)
+	if err != nil {
+		return err
+	}
+
+	err = pushCounter(client, counters, mode, host, prefix+".deletes", opscounters.Delete)
+	if err != nil {
+		return err
+	}
+
+	err = pushCounter(client, counters, mode, host, prefix+".getmores", opscounters.GetMore)
+	if err != nil {
+		return err
+	}
+
+	err = pushCounter(client, counters, mode, host, prefix+".commands", opscounters.Command)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func pushStorageEngine(client statsd.Statter, engine string) error {
+	return client.Gauge("storage_engine."+metricName(engine), 1, 1.0)
+}
+
+func pushMem(client statsd.Statter, mem Mem, engine string, units Units) error {
+	var err error
+
+	err = units.gaugeMemory(client, "mem.resident", mem.Resident)
+	if err != nil {
+		return err
+	}
+
+	err = units.gaugeMemory(client, "mem.virtual", mem.Virtual)
+	if err != nil {
+		return err
+	}
+
+	// Mapped memory only exists for the memory-mapped engine.
+	if engine != engineMMAPv1 {
+		return nil
+	}
+
+	err = units.gaugeMemory(client, "mem.mapped", mem.Mapped)
+	if err != nil {
+		return err
+	}
+
+	err = units.gaugeMemory(client, "mem.mapped_with_journal", mem.MappedWithJournal)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func pushGlobalLocks(client statsd.Statter, glob GlobalLock, l layout, units Units) error {
+	var err error
+
+	err = units.gaugeMicros(client, "global_lock.total_time", glob.TotalTime)
+	if err != nil {
+		return err
+	}
+
+	if l.LockTime {
+		err = units.gaugeMicros(client, "global_lock.lock_time", glob.LockTime)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = client.Gauge("global_lock.active_readers", glob.ActiveClients.Readers, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("global_lock.active_writers", glob.ActiveClients.Writers, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("global_lock.active_total", glob.ActiveClients.Total, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("global_lock.queued_readers", glob.CurrentQueue.Readers, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("global_lock.queued_writers", glob.CurrentQueue.Writers, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("global_lock.queued_total", glob.CurrentQueue.Total, 1.0)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func pushExtraInfo(client statsd.Statter, info ExtraInfo) error {
+	var err error
+
+	err = client.Gauge("extra.page_faults", info.PageFaults, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("extra.heap_usage", info.HeapUsageInBytes, 1.0)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func newStatter(statsd_config Statsd, host string) (statsd.Statter, error) {
+	n := namingFor(statsd_config.Naming)
+	prefix := n.prefix(statsd_config, host)
+	sender := statsd_config.sender
+	if sender == nil {
+		var err error
+		sender, err = newSender(statsd_config)
+		if statsd_config.Spool.Size > 0 {
+			// Spool even when the destination can't be resolved.
+			sender, err = statsd_config.spools.get(statsd_config).wrap(sender, err), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if statsd_config.PacketSize > 0 {
+		sender = newBufferedSender(sender, statsd_config.PacketSize)
+	}
+	if n.hostTags {
+		sender = newTagSender(sender, hostTags(statsd_config, host))
+	} else if statsd_config.TagStyle == tagStyleDogStatsd && len(statsd_config.Tags) > 0 {
+		sender = newTagSender(sender, statsd_config.Tags)
+	}
+
+	var client statsd.Statter
+	client, err := statsd.NewClientWithSender(sender, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if len(n.rename) > 0 {
+		client = &renamingStatter{Statter: client, rename: n.rename}
+	}
+	if statsd_config.Rollup.Samples > 0 {
+		client = &rollupStatter{Statter: client, rollup: statsd_config.Rollup, windows: statsd_config.windows, prefix: prefix + "/" + host + "/"}
+	}
+	if len(statsd_config.Processors) > 0 {
+		client = newProcessingStatter(client, statsd_config.Processors)
+	}
+	return client, nil
+}
+
+// closeStatter closes client, which flushes any buffered metrics, and
+// stores the error in err unless it already holds one.
+func closeStatter(client statsd.Statter, err *error) {
+	cerr := client.Close()
+	if *err == nil {
+		*err = cerr
+	}
+}
+
+func pushBackgroundFlushing(client statsd.Statter, flushing BackgroundFlushing) error {
+	var err error
+
+	err = client.Gauge("flushing.flushes", flushing.Flushes, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("flushing.total_ms", flushing.TotalMs, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("flushing.average_ms", flushing.AverageMs, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("flushing.last_ms", flushing.LastMs, 1.0)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// pushStats sends every metric family of status. A family that fails is
+// recorded and the rest are still pushed; the returned error lists every
+// failed family.
+func pushStats(config Config, status ServerStatus, elapsed time.Duration) (err error) {
+	client, err := newStatter(config.Statsd, status.Host)
+	if err != nil {
+		return err
+	}
+	defer closeStatter(client, &err)
+
+	counted := &countingStatter{Statter: client}
+	var errs pushErrors
+
+	errs.add("collect_time", pushCollectTime(counted, "server_status", elapsed))
+	errs.add("server", pushServer(counted, config.state.processes, status, config.Metrics.Units))
+	errs.add("clock", pushClock(counted, status))
+	errs.add("connections", pushConnections(counted, "connections", status.Connections))
+
+	// Ops Counters (non-RS)
+	errs.add("ops", pushOpcounters(counted, config.state.counters, config.Metrics.Counters, status.Host, "ops", status.Opcounters))
+
+	// Operations replicated to this member, only non-zero on secondaries.
+	errs.add("ops_repl", pushOpcounters(counted, config.state.counters, config.Metrics.Counters, status.Host, "ops_repl", status.OpcountersReplicaSet))
+
+	errs.add("storage_engine", pushStorageEngine(counted, status.engine()))
+	errs.add("mem", pushMem(counted, status.Mem, status.engine(), config.Metrics.Units))
+
+	// Background flushes are how MMAPv1 writes data files to disk.
+	if status.engine() == engineMMAPv1 {
+		errs.add("flushing", pushBackgroundFlushing(counted, status.BackgroundFlushing))
+		errs.add("dur", pushDur(counted, status.Dur))
+	}
+
+	if status.engine() == engineWiredTiger {
+		errs.add("wired_tiger", pushWiredTiger(counted, status.WiredTiger))
+	}
+
+	errs.add("global_locks", pushGlobalLocks(counted, status.GlobalLocks, status.layout(), config.Metrics.Units))
+	errs.add("extra_info", pushExtraInfo(counted, status.ExtraInfo))
+	errs.add("ttl", pushTTL(counted, config.state.counters, status.Host, status.Metrics.TTL))
+	errs.add("write_concern", pushWriteConcern(counted, config.state.counters, status.Host, status.Metrics.GetLastError))
+	errs.add("free_monitoring", pushFreeMonitoring(counted, status.FreeMonitoring))
+	errs.add("asserts", pushAsserts(counted, config.state.counters, status.Host, status.Asserts))
+	errs.add("security", pushAuthentication(counted, config.state.counters, status.Host, status.Security))
+
+	if status.layout().OpLatencies {
+		errs.add("op_latencies", pushOpLatencies(counted, config.state.counters, status.Host, status.OpLatencies))
+	}
+
+	if status.layout().FlowControl {
+		errs.add("flow_control", pushFlowControl(counted, config.state.counters, status.Host, status.FlowControl))
+	}
+
+	patterns := config.Metrics.patterns()
+	if len(patterns) > 0 || len(config.Alerts) > 0 {
+		var doc bson.M
+		uerr := status.raw.Unmarshal(&doc)
+		errs.add("raw", uerr)
+
+		if uerr == nil {
+			if len(patterns) > 0 {
+				errs.add("server_status", pushPaths(counted, "server_status.", doc, patterns))
+			}
+			errs.add("alerts", pushAlerts(counted, config.state.alerts, status.Host, config.Alerts, doc))
+		}
+	}
+
+	logf(LevelDebug, "%s: pushed %d metrics, %d failed", status.Host, counted.sent, counted.failed)
+	errs.add("push_counts", pushCounts(client, counted))
+
+	return errs.err()
+}
+
+func collectServerStatus(session *mgo.Session, config Config) error {
+	start := time.Now()
+	status, err := serverStatus(session, config)
+	if err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+	status.sampled = start.Add(elapsed / 2)
+
+	if config.aggregate != nil {
+		config.aggregate.addStatus(config, status)
+	}
+	return pushStats(config, status, elapsed)
+}
@@ -0,0 +1,196 @@
+package mgostatsd
+
+import (
+	"bytes"
+	"github.com/cactus/go-statsd-client/statsd"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// Spool keeps metrics that could not be sent, up to Size bytes, and
+// retries them before the next metrics sent to the same destination. When
+// full the oldest metrics are dropped. With Path set the spool is also
+// kept in that file, so it survives a restart of the agent. A zero Size
+// disables spooling.
+type Spool struct {
+	Size int    "size"
+	Path string "path"
+}
+
+// spool holds the unsent metric lines for one statsd destination. It
+// outlives the senders wrapped around every push.
+type spool struct {
+	config Spool
+	dest   string
+
+	mu      sync.Mutex
+	lines   [][]byte
+	bytes   int
+	dropped int
+	dirty   bool
+}
+
+// spoolStore holds the spool of every destination an Agent sends to.
+type spoolStore struct {
+	mu sync.Mutex
+	m  map[string]*spool
+}
+
+func destination(statsd_config Statsd) string {
+	switch statsd_config.Transport {
+	case transportUnix, transportUnixgram:
+		return statsd_config.Transport + ":" + statsd_config.Socket
+	}
+	return statsd_config.Transport + ":" + hostPort(statsd_config)
+}
+
+// get returns the spool of the destination of statsd_config, loading it
+// from its file the first time.
+func (spools *spoolStore) get(statsd_config Statsd) *spool {
+	dest := destination(statsd_config)
+
+	spools.mu.Lock()
+	defer spools.mu.Unlock()
+
+	s, ok := spools.m[dest]
+	if !ok {
+		s = &spool{config: statsd_config.Spool, dest: dest}
+		s.load()
+		spools.m[dest] = s
+	}
+	return s
+}
+
+func (s *spool) load() {
+	if len(s.config.Path) == 0 {
+		return
+	}
+	data, err := ioutil.ReadFile(s.config.Path)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		logf(LevelError, "spool %s: %s", s.config.Path, err)
+		return
+	}
+	s.add(data)
+	s.dirty = false
+	if len(s.lines) > 0 {
+		logf(LevelInfo, "spool %s: loaded %d metrics", s.config.Path, len(s.lines))
+	}
+}
+
+// save rewrites the spool file if the contents changed. s.mu must be
+// held.
+func (s *spool) save() {
+	if len(s.config.Path) == 0 || !s.dirty {
+		return
+	}
+	s.dirty = false
+	tmp := s.config.Path + ".tmp"
+	err := ioutil.WriteFile(tmp, bytes.Join(append(s.lines, nil), []byte("\n")), 0600)
+	if err == nil {
+		err = os.Rename(tmp, s.config.Path)
+	}
+	if err != nil {
+		logf(LevelError, "spool %s: %s", s.config.Path, err)
+	}
+}
+
+// add spools every metric line of data, dropping the oldest lines beyond
+// the size limit. s.mu must be held, except while loading.
+func (s *spool) add(data []byte) {
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		s.lines = append(s.lines, append([]byte(nil), line...))
+		s.bytes += len(line)
+		s.dirty = true
+	}
+	for s.bytes > s.config.Size && len(s.lines) > 0 {
+		s.bytes -= len(s.lines[0])
+		s.lines = s.lines[1:]
+		s.dropped++
+	}
+}
+
+// flush sends the spooled lines in order, stopping at the first failure.
+// s.mu must be held.
+func (s *spool) flush(sender statsd.Sender) error {
+	if len(s.lines) == 0 {
+		return nil
+	}
+
+	sent := 0
+	var err error
+	for _, line := range s.lines {
+		_, err = sender.Send(line)
+		if err != nil {
+			break
+		}
+		s.bytes -= len(line)
+		sent++
+	}
+	s.lines = s.lines[sent:]
+	if sent > 0 {
+		s.dirty = true
+	}
+	if len(s.lines) == 0 {
+		logf(LevelInfo, "statsd %s reachable again: delivered %d spooled metrics, dropped %d", s.dest, sent, s.dropped)
+		s.dropped = 0
+	}
+	return err
+}
+
+// spoolSender sends through sender, which is nil if it could not be
+// created, and spools whatever can't be sent.
+type spoolSender struct {
+	sender statsd.Sender
+	spool  *spool
+	cause  error
+}
+
+// wrap returns a sender that spools to s. err is the error creating
+// sender, which is spooled around until the destination can be reached.
+func (s *spool) wrap(sender statsd.Sender, err error) *spoolSender {
+	if err != nil {
+		sender = nil
+	}
+	return &spoolSender{sender: sender, spool: s, cause: err}
+}
+
+func (s *spoolSender) Send(data []byte) (int, error) {
+	s.spool.mu.Lock()
+	defer s.spool.mu.Unlock()
+
+	err := s.cause
+	if s.sender != nil {
+		err = s.spool.flush(s.sender)
+		if err == nil {
+			_, err = s.sender.Send(data)
+			if err == nil {
+				return len(data), nil
+			}
+		}
+	}
+
+	if len(s.spool.lines) == 0 {
+		logf(LevelWarn, "statsd %s unreachable, spooling metrics: %s", s.spool.dest, err)
+	}
+	s.spool.add(data)
+	return len(data), nil
+}
+
+// Close writes the spool file once per push rather than on every metric.
+func (s *spoolSender) Close() error {
+	s.spool.mu.Lock()
+	s.spool.save()
+	s.spool.mu.Unlock()
+
+	if s.sender == nil {
+		return nil
+	}
+	return s.sender.Close()
+}
@@ -0,0 +1,169 @@
+package mgostatsd
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// failingSender records what it sends while up, and fails every send
+// while down.
+type failingSender struct {
+	down bool
+	sent []string
+}
+
+func (s *failingSender) Send(data []byte) (int, error) {
+	if s.down {
+		return 0, errors.New("connection refused")
+	}
+	s.sent = append(s.sent, string(data))
+	return len(data), nil
+}
+
+func (s *failingSender) Close() error {
+	return nil
+}
+
+func spooledLines(s *spool) []string {
+	lines := make([]string, len(s.lines))
+	for i, line := range s.lines {
+		lines[i] = string(line)
+	}
+	return lines
+}
+
+func TestSpoolSender(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+		// down[i] makes the sender fail while sends[i] is sent.
+		down    []bool
+		sends   []string
+		sent    []string
+		spooled []string
+		dropped int
+	}{
+		{
+			name:    "up",
+			size:    100,
+			down:    []bool{false, false},
+			sends:   []string{"a:1|c", "b:2|c"},
+			sent:    []string{"a:1|c", "b:2|c"},
+			spooled: []string{},
+		},
+		{
+			name:    "down spools",
+			size:    100,
+			down:    []bool{true, true},
+			sends:   []string{"a:1|c", "b:2|c"},
+			sent:    nil,
+			spooled: []string{"a:1|c", "b:2|c"},
+		},
+		{
+			name:    "retried in order before the next metric",
+			size:    100,
+			down:    []bool{true, true, false},
+			sends:   []string{"a:1|c", "b:2|c", "c:3|c"},
+			sent:    []string{"a:1|c", "b:2|c", "c:3|c"},
+			spooled: []string{},
+		},
+		{
+			name:    "a packet of several metrics is spooled line by line",
+			size:    100,
+			down:    []bool{true, false},
+			sends:   []string{"a:1|c\nb:2|c", "c:3|c"},
+			sent:    []string{"a:1|c", "b:2|c", "c:3|c"},
+			spooled: []string{},
+		},
+		{
+			name:    "overflow drops the oldest lines",
+			size:    10,
+			down:    []bool{true, true, true},
+			sends:   []string{"a:1|c", "b:2|c", "c:3|c"},
+			sent:    nil,
+			spooled: []string{"b:2|c", "c:3|c"},
+			dropped: 1,
+		},
+		{
+			name:    "overflow then retry delivers what is left",
+			size:    10,
+			down:    []bool{true, true, true, false},
+			sends:   []string{"a:1|c", "b:2|c", "c:3|c", "d:4|c"},
+			sent:    []string{"b:2|c", "c:3|c", "d:4|c"},
+			spooled: []string{},
+		},
+	}
+	for _, tt := range tests {
+		s := &spool{config: Spool{Size: tt.size}, dest: "tcp:statsd:8125"}
+		sender := &failingSender{}
+		spooling := s.wrap(sender, nil)
+		for i, data := range tt.sends {
+			sender.down = tt.down[i]
+			n, err := spooling.Send([]byte(data))
+			if n != len(data) || err != nil {
+				t.Errorf("%s: Send(%q) = %d, %v, want %d, nil", tt.name, data, n, err, len(data))
+			}
+		}
+		if !reflect.DeepEqual(sender.sent, tt.sent) {
+			t.Errorf("%s: sent %q, want %q", tt.name, sender.sent, tt.sent)
+		}
+		if got := spooledLines(s); !reflect.DeepEqual(got, tt.spooled) {
+			t.Errorf("%s: spooled %q, want %q", tt.name, got, tt.spooled)
+		}
+		if s.dropped != tt.dropped {
+			t.Errorf("%s: dropped %d, want %d", tt.name, s.dropped, tt.dropped)
+		}
+	}
+}
+
+func TestSpoolSenderUnresolved(t *testing.T) {
+	s := &spool{config: Spool{Size: 100}, dest: "udp:statsd:8125"}
+	spooling := s.wrap(nil, errors.New("no such host"))
+	_, err := spooling.Send([]byte("a:1|c"))
+	if err != nil {
+		t.Fatalf("Send: %s", err)
+	}
+	if got, want := spooledLines(s), []string{"a:1|c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("spooled %q, want %q", got, want)
+	}
+	err = spooling.Close()
+	if err != nil {
+		t.Errorf("Close: %s", err)
+	}
+}
+
+func TestSpoolFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := Spool{Size: 100, Path: filepath.Join(dir, "spool")}
+
+	s := &spool{config: config, dest: "tcp:statsd:8125"}
+	spooling := s.wrap(&failingSender{down: true}, nil)
+	spooling.Send([]byte("a:1|c\nb:2|c"))
+	spooling.Close()
+
+	// A new agent picks up where the last one stopped.
+	s = &spool{config: config, dest: "tcp:statsd:8125"}
+	s.load()
+	sender := &failingSender{}
+	spooling = s.wrap(sender, nil)
+	spooling.Send([]byte("c:3|c"))
+	spooling.Close()
+	if want := []string{"a:1|c", "b:2|c", "c:3|c"}; !reflect.DeepEqual(sender.sent, want) {
+		t.Errorf("sent %q, want %q", sender.sent, want)
+	}
+	data, err := ioutil.ReadFile(config.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 0 {
+		t.Errorf("spool file holds %q after delivery", data)
+	}
+}
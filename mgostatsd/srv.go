@@ -0,0 +1,57 @@
+package mgostatsd
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const srvScheme = "mongodb+srv://"
+
+// Srv discovers targets from the _mongodb._tcp SRV records of Name, as a
+// mongodb+srv:// connection string does, re-resolving them every Refresh.
+// The records seed one replica set connection unless Direct is set, in
+// which case every record is polled as its own target.
+type Srv struct {
+	Name    string        "name"
+	Direct  bool          "direct"
+	Refresh time.Duration "refresh"
+}
+
+func (s Srv) enabled() bool {
+	return len(s.Name) > 0
+}
+
+type srvDiscoverer struct {
+	config Srv
+}
+
+func (d srvDiscoverer) discover() ([]Target, error) {
+	_, records, err := net.LookupSRV("mongodb", "tcp", d.config.Name)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no _mongodb._tcp SRV records for %s", d.config.Name)
+	}
+
+	addrs := make([]string, len(records))
+	for i, r := range records {
+		addrs[i] = net.JoinHostPort(strings.TrimSuffix(r.Target, "."), strconv.Itoa(int(r.Port)))
+	}
+	// Lookup order is randomized by weight; sort so an unchanged record set
+	// is recognized as the same target.
+	sort.Strings(addrs)
+
+	if !d.config.Direct {
+		return []Target{{Addresses: addrs}}, nil
+	}
+	targets := make([]Target, len(addrs))
+	for i, addr := range addrs {
+		targets[i] = Target{Addresses: []string{addr}, Direct: true}
+	}
+	return targets, nil
+}
@@ -0,0 +1,33 @@
+package mgostatsd
+
+// state is what an Agent remembers from one poll to the next. Every Agent
+// has its own, so agents in one process don't share delta baselines,
+// alert states, rollup windows, spools or statsd connections.
+type state struct {
+	counters  *counterStore
+	alerts    *alertStore
+	processes *processStore
+	windows   *windowStore
+	spools    *spoolStore
+	streams   *streamStore
+}
+
+func newState() *state {
+	return &state{
+		counters:  &counterStore{last: make(map[string]int64)},
+		alerts:    &alertStore{breached: make(map[string]bool)},
+		processes: &processStore{last: make(map[string]processSample)},
+		windows:   &windowStore{samples: make(map[string][]int64)},
+		spools:    &spoolStore{m: make(map[string]*spool)},
+		streams:   &streamStore{m: make(map[string]*streamSender)},
+	}
+}
+
+// withState returns c remembering its polls in s.
+func (c Config) withState(s *state) Config {
+	c.state = s
+	c.Statsd.windows = s.windows
+	c.Statsd.spools = s.spools
+	c.Statsd.streams = s.streams
+	return c
+}
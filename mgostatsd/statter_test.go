@@ -0,0 +1,117 @@
+package mgostatsd
+
+import (
+	"fmt"
+	"github.com/cactus/go-statsd-client/statsd"
+	"time"
+)
+
+// fakeStatter records every metric sent through it as a statsd line,
+// name:value|type, without a prefix. Its sub-statters record into the
+// same lines, with their prefix.
+type fakeStatter struct {
+	lines []string
+}
+
+func (s *fakeStatter) NewSubStatter(prefix string) statsd.SubStatter {
+	return &fakeSubStatter{fakeStatter: s, prefix: prefix + "."}
+}
+
+type fakeSubStatter struct {
+	*fakeStatter
+	prefix string
+}
+
+func (s *fakeSubStatter) send(stat string, value interface{}, kind string) error {
+	return s.fakeStatter.send(s.prefix+stat, value, kind)
+}
+
+func (s *fakeSubStatter) Inc(stat string, value int64, rate float32) error {
+	return s.send(stat, value, "c")
+}
+
+func (s *fakeSubStatter) Dec(stat string, value int64, rate float32) error {
+	return s.send(stat, -value, "c")
+}
+
+func (s *fakeSubStatter) Gauge(stat string, value int64, rate float32) error {
+	return s.send(stat, value, "g")
+}
+
+func (s *fakeSubStatter) GaugeDelta(stat string, value int64, rate float32) error {
+	return s.send(stat, fmt.Sprintf("%+d", value), "g")
+}
+
+func (s *fakeSubStatter) Timing(stat string, delta int64, rate float32) error {
+	return s.send(stat, delta, "ms")
+}
+
+func (s *fakeSubStatter) TimingDuration(stat string, delta time.Duration, rate float32) error {
+	return s.send(stat, int64(delta/time.Millisecond), "ms")
+}
+
+func (s *fakeSubStatter) Set(stat string, value string, rate float32) error {
+	return s.send(stat, value, "s")
+}
+
+func (s *fakeSubStatter) SetInt(stat string, value int64, rate float32) error {
+	return s.send(stat, value, "s")
+}
+
+func (s *fakeSubStatter) Raw(stat string, value string, rate float32) error {
+	return s.fakeStatter.Raw(s.prefix+stat, value, rate)
+}
+
+func (s *fakeSubStatter) NewSubStatter(prefix string) statsd.SubStatter {
+	return &fakeSubStatter{fakeStatter: s.fakeStatter, prefix: s.prefix + prefix + "."}
+}
+
+func (s *fakeSubStatter) SetSamplerFunc(sampler statsd.SamplerFunc) {}
+
+func (s *fakeStatter) send(stat string, value interface{}, kind string) error {
+	s.lines = append(s.lines, fmt.Sprintf("%s:%v|%s", stat, value, kind))
+	return nil
+}
+
+func (s *fakeStatter) Inc(stat string, value int64, rate float32) error {
+	return s.send(stat, value, "c")
+}
+
+func (s *fakeStatter) Dec(stat string, value int64, rate float32) error {
+	return s.send(stat, -value, "c")
+}
+
+func (s *fakeStatter) Gauge(stat string, value int64, rate float32) error {
+	return s.send(stat, value, "g")
+}
+
+func (s *fakeStatter) GaugeDelta(stat string, value int64, rate float32) error {
+	return s.send(stat, fmt.Sprintf("%+d", value), "g")
+}
+
+func (s *fakeStatter) Timing(stat string, delta int64, rate float32) error {
+	return s.send(stat, delta, "ms")
+}
+
+func (s *fakeStatter) TimingDuration(stat string, delta time.Duration, rate float32) error {
+	return s.send(stat, int64(delta/time.Millisecond), "ms")
+}
+
+func (s *fakeStatter) Set(stat string, value string, rate float32) error {
+	return s.send(stat, value, "s")
+}
+
+func (s *fakeStatter) SetInt(stat string, value int64, rate float32) error {
+	return s.send(stat, value, "s")
+}
+
+func (s *fakeStatter) Raw(stat string, value string, rate float32) error {
+	s.lines = append(s.lines, stat+":"+value)
+	return nil
+}
+
+func (s *fakeStatter) SetPrefix(prefix string) {}
+
+func (s *fakeStatter) Close() error {
+	return nil
+}
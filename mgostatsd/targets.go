@@ -0,0 +1,196 @@
+package mgostatsd
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Target is one Mongo deployment the agent polls. Direct targets are a
+// single server; otherwise Addresses seed a replica set connection. Tags
+// describe where the target came from and are attached to its metrics,
+// and Statsd, when set, is where they are sent instead of the configured
+// statsd.
+type Target struct {
+	Addresses []string          `json:"addresses"`
+	Direct    bool              `json:"direct"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Statsd    *Destination      `json:"statsd,omitempty"`
+}
+
+func (t Target) String() string {
+	return strings.Join(t.Addresses, ",")
+}
+
+// label is t as a single statsd path component, for the metrics named
+// after the target rather than a server's host name. The colons of its
+// ports and the commas between its addresses would otherwise break the
+// statsd line.
+func (t Target) label() string {
+	return metricName(t.String())
+}
+
+// defaultMongoPort is the port mgo connects to when an address has none.
+const defaultMongoPort = "27017"
+
+// mongoScheme is the scheme of a mongodb:// connection string.
+const mongoScheme = "mongodb://"
+
+// normalizeAddress brackets a bare IPv6 literal, as in [::1]:27017, so it
+// can't be mistaken for host:port, and strips the mongodb:// scheme from a
+// single host written as a connection string. Other addresses are
+// returned as they are.
+func normalizeAddress(addr string) string {
+	if strings.HasPrefix(addr, mongoScheme) {
+		host := strings.TrimSuffix(strings.TrimPrefix(addr, mongoScheme), "/")
+		if !strings.ContainsAny(host, "@,/?") {
+			addr = host
+		}
+	}
+	host := strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	if strings.Contains(host, ":") && net.ParseIP(host) != nil {
+		return net.JoinHostPort(host, defaultMongoPort)
+	}
+	return addr
+}
+
+// normalizeAddresses normalizes every address of addrs, leaving out those
+// that repeat an earlier one once normalized.
+func normalizeAddresses(addrs []string) []string {
+	normalized := make([]string, 0, len(addrs))
+	seen := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		addr = normalizeAddress(addr)
+		if seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		normalized = append(normalized, addr)
+	}
+	return normalized
+}
+
+// validAddress reports whether addr is host, host:port, an IPv6 literal
+// on its own or a bracketed one with a port, as in [::1]:27017. A
+// connection string is not an address.
+func validAddress(addr string) bool {
+	if strings.Contains(addr, "://") {
+		return false
+	}
+	if strings.Count(addr, ":") < 2 || net.ParseIP(strings.Trim(addr, "[]")) != nil {
+		return true
+	}
+	_, port, err := net.SplitHostPort(addr)
+	return err == nil && len(port) > 0 && strings.HasPrefix(addr, "[")
+}
+
+// targetSet holds the targets currently being polled. Discovery replaces
+// them while collectors are running.
+type targetSet struct {
+	mu      sync.RWMutex
+	targets []Target
+}
+
+func (s *targetSet) list() []Target {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.targets
+}
+
+func (s *targetSet) set(targets []Target) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := make(map[string]bool, len(s.targets))
+	for _, t := range s.targets {
+		old[t.String()] = true
+	}
+	for _, t := range targets {
+		if !old[t.String()] {
+			logf(LevelInfo, "adding target %s", t)
+		}
+		delete(old, t.String())
+	}
+	for name := range old {
+		logf(LevelInfo, "removing target %s", name)
+	}
+
+	s.targets = targets
+}
+
+// A discoverer lists the targets that currently exist.
+type discoverer interface {
+	discover() ([]Target, error)
+}
+
+// watch refreshes targets from d every refresh until quit is closed. On
+// error the previous targets are kept.
+func watch(d discoverer, refresh time.Duration, targets *targetSet, quit <-chan struct{}) {
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			discovered, err := d.discover()
+			if err != nil {
+				logf(LevelError, "discovery: %s", err)
+				continue
+			}
+			targets.set(discovered)
+		case <-quit:
+			return
+		}
+	}
+}
+
+// newTargets returns the initial targets and, if they are discovered,
+// the discoverer that keeps them up to date.
+func newTargets(config Config) (*targetSet, discoverer, error) {
+	targets := &targetSet{}
+	d, err := config.Discovery.discoverer()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if d == nil && len(config.Targets) > 0 {
+		static := make([]Target, len(config.Targets))
+		for i, s := range config.Targets {
+			static[i] = s.target()
+		}
+		targets.set(static)
+		return targets, nil, nil
+	}
+	if d == nil {
+		targets.set([]Target{{Addresses: config.Mongo.Addresses}})
+		return targets, nil, nil
+	}
+
+	discovered, err := d.discover()
+	if err != nil {
+		return nil, nil, err
+	}
+	targets.set(discovered)
+	return targets, d, nil
+}
+
+// mergeTags returns the union of the tag sets, later ones winning.
+func mergeTags(tags ...map[string]string) map[string]string {
+	merged := make(map[string]string)
+	for _, set := range tags {
+		for k, v := range set {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+func sortedTagKeys(tags map[string]string) []string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,95 @@
+package mgostatsd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"gopkg.in/mgo.v2"
+	"io/ioutil"
+	"net"
+)
+
+const (
+	authX509 = "MONGODB-X509"
+	// mgo has no SASL mechanism for MONGODB-AWS, so Validate rejects
+	// it.
+	authAWS = "MONGODB-AWS"
+)
+
+// TLS connects to Mongo over TLS. CAFile verifies the servers instead of
+// the system roots, and CertFile and KeyFile are the client certificate,
+// which MONGODB-X509 authenticates with.
+type TLS struct {
+	Enabled            bool   "enabled"
+	CAFile             string "ca_file"
+	CertFile           string "cert_file"
+	KeyFile            string "key_file"
+	InsecureSkipVerify bool   "insecure_skip_verify"
+}
+
+// config loads the files on every dial, so renewed certificates are
+// picked up without a restart. It also returns the parsed client
+// certificate, if any.
+func (t TLS) config() (*tls.Config, *x509.Certificate, error) {
+	config := &tls.Config{InsecureSkipVerify: t.InsecureSkipVerify}
+
+	if len(t.CAFile) > 0 {
+		ca, err := ioutil.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, nil, fmt.Errorf("no certificates in %s", t.CAFile)
+		}
+	}
+
+	if len(t.CertFile) == 0 {
+		return config, nil, nil
+	}
+	key := t.KeyFile
+	if len(key) == 0 {
+		// The key is often kept in the same PEM file as the certificate.
+		key = t.CertFile
+	}
+	cert, err := tls.LoadX509KeyPair(t.CertFile, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	config.Certificates = []tls.Certificate{cert}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	return config, leaf, nil
+}
+
+// subjectDN returns the subject of cert as the RFC 2253 distinguished
+// name MONGODB-X509 users are named by: its RDNs in reverse order, as in
+// CN=mgo-statsd,OU=ops,O=Example,C=US. It is read from the raw subject so
+// the RDNs keep the order and attributes they have in the certificate.
+func subjectDN(cert *x509.Certificate) (string, error) {
+	var rdns pkix.RDNSequence
+	_, err := asn1.Unmarshal(cert.RawSubject, &rdns)
+	if err != nil {
+		return "", fmt.Errorf("certificate subject: %s", err)
+	}
+	return rdns.String(), nil
+}
+
+// dialTLS makes info connect over TLS, and returns the client
+// certificate for MONGODB-X509.
+func dialTLS(info *mgo.DialInfo, t TLS) (*x509.Certificate, error) {
+	config, cert, err := t.config()
+	if err != nil {
+		return nil, err
+	}
+	info.DialServer = func(addr *mgo.ServerAddr) (net.Conn, error) {
+		dialer := &net.Dialer{Timeout: info.Timeout}
+		return tls.DialWithDialer(dialer, "tcp", addr.String(), config)
+	}
+	return cert, nil
+}
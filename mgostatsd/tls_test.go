@@ -0,0 +1,61 @@
+package mgostatsd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+)
+
+func TestSubjectDN(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		subject pkix.Name
+		want    string
+	}{
+		{pkix.Name{CommonName: "mgo-statsd"}, "CN=mgo-statsd"},
+		{
+			pkix.Name{CommonName: "mgo-statsd", OrganizationalUnit: []string{"ops"}, Organization: []string{"Example"}, Country: []string{"US"}},
+			"CN=mgo-statsd,OU=ops,O=Example,C=US",
+		},
+		{
+			pkix.Name{CommonName: "mgo-statsd", Locality: []string{"Berlin"}, Province: []string{"Berlin"}, Organization: []string{"Example, Inc."}},
+			`CN=mgo-statsd,O=Example\, Inc.,L=Berlin,ST=Berlin`,
+		},
+		{
+			// RDNs in an order Go wouldn't write them in are kept as
+			// they are in the certificate.
+			pkix.Name{ExtraNames: []pkix.AttributeTypeAndValue{
+				{Type: asn1.ObjectIdentifier{2, 5, 4, 3}, Value: "mgo-statsd"},
+				{Type: asn1.ObjectIdentifier{2, 5, 4, 11}, Value: "ops"},
+			}},
+			"OU=ops,CN=mgo-statsd",
+		},
+	}
+	for i, tt := range tests {
+		template := &x509.Certificate{SerialNumber: big.NewInt(int64(i + 1)), Subject: tt.subject}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := subjectDN(cert)
+		if err != nil {
+			t.Fatalf("subjectDN(%v): %s", tt.subject, err)
+		}
+		if got != tt.want {
+			t.Errorf("subjectDN(%v) = %q, want %q", tt.subject, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package mgostatsd
+
+import (
+	"fmt"
+	"github.com/cactus/go-statsd-client/statsd"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	transportUDP      = "udp"
+	transportTCP      = "tcp"
+	transportUnix     = "unix"
+	transportUnixgram = "unixgram"
+)
+
+const dialTimeout = 5 * time.Second
+
+// datagramSender sends each packet as one datagram on a Unix socket.
+type datagramSender struct {
+	conn net.Conn
+}
+
+func (s *datagramSender) Send(data []byte) (int, error) {
+	return s.conn.Write(data)
+}
+
+func (s *datagramSender) Close() error {
+	return s.conn.Close()
+}
+
+// streamSender writes packets to a TCP or Unix stream socket. Statsd
+// separates metrics on a stream by newlines, so one is added to each
+// packet. A broken connection is redialed and the write retried once.
+type streamSender struct {
+	network string
+	addr    string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (s *streamSender) Send(data []byte) (int, error) {
+	line := make([]byte, len(data), len(data)+1)
+	copy(line, data)
+	if len(line) == 0 || line[len(line)-1] != '\n' {
+		line = append(line, '\n')
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.conn == nil {
+			s.conn, err = net.DialTimeout(s.network, s.addr, dialTimeout)
+			if err != nil {
+				return 0, err
+			}
+		}
+		_, err = s.conn.Write(line)
+		if err == nil {
+			return len(data), nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+	return 0, err
+}
+
+func (s *streamSender) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// streamStore holds one streamSender per tcp or unix destination, so an
+// Agent keeps its connections open from one push to the next instead of
+// dialing statsd for every push. The connections are closed when the
+// Agent stops.
+type streamStore struct {
+	mu sync.Mutex
+	m  map[string]*streamSender
+}
+
+// get returns the sender to addr over network, wrapped so that closing it
+// at the end of a push leaves the connection open. Without a store, as in
+// a Config that New didn't set up, every push gets its own connection.
+func (streams *streamStore) get(network string, addr string) statsd.Sender {
+	if streams == nil {
+		return &streamSender{network: network, addr: addr}
+	}
+
+	streams.mu.Lock()
+	defer streams.mu.Unlock()
+
+	key := network + ":" + addr
+	s, ok := streams.m[key]
+	if !ok {
+		s = &streamSender{network: network, addr: addr}
+		streams.m[key] = s
+	}
+	return keptSender{s}
+}
+
+// close closes every connection in the store.
+func (streams *streamStore) close() {
+	streams.mu.Lock()
+	defer streams.mu.Unlock()
+
+	for _, s := range streams.m {
+		s.Close()
+	}
+}
+
+// keptSender is a streamSender shared by every push to its destination.
+type keptSender struct {
+	*streamSender
+}
+
+func (s keptSender) Close() error {
+	return nil
+}
+
+// bufferedSender packs as many metrics as fit in size bytes into each
+// packet, separated by newlines, instead of sending one packet per metric.
+// Whatever is left is sent on Close, at the end of each push.
+type bufferedSender struct {
+	sender statsd.Sender
+	size   int
+	buf    []byte
+}
+
+func newBufferedSender(sender statsd.Sender, size int) *bufferedSender {
+	return &bufferedSender{sender: sender, size: size, buf: make([]byte, 0, size)}
+}
+
+func (s *bufferedSender) Send(data []byte) (int, error) {
+	if len(s.buf) > 0 && len(s.buf)+1+len(data) > s.size {
+		err := s.flush()
+		if err != nil {
+			return 0, err
+		}
+	}
+	if len(s.buf) > 0 {
+		s.buf = append(s.buf, '\n')
+	}
+	s.buf = append(s.buf, data...)
+	return len(data), nil
+}
+
+func (s *bufferedSender) flush() error {
+	if len(s.buf) == 0 {
+		return nil
+	}
+	_, err := s.sender.Send(s.buf)
+	s.buf = s.buf[:0]
+	return err
+}
+
+func (s *bufferedSender) Close() error {
+	err := s.flush()
+	cerr := s.sender.Close()
+	if err == nil {
+		err = cerr
+	}
+	return err
+}
+
+const (
+	tagStylePath      = "path"
+	tagStyleDogStatsd = "dogstatsd"
+)
+
+// tagSender appends DogStatsD-style tags to each metric it sends. It must
+// see metrics one at a time, so it wraps any bufferedSender.
+type tagSender struct {
+	sender statsd.Sender
+	suffix []byte
+}
+
+func newTagSender(sender statsd.Sender, tags map[string]string) *tagSender {
+	pairs := make([]string, 0, len(tags))
+	for _, k := range sortedTagKeys(tags) {
+		pairs = append(pairs, k+":"+tags[k])
+	}
+	return &tagSender{sender: sender, suffix: []byte("|#" + strings.Join(pairs, ","))}
+}
+
+func (s *tagSender) Send(data []byte) (int, error) {
+	line := make([]byte, 0, len(data)+len(s.suffix))
+	line = append(append(line, data...), s.suffix...)
+	_, err := s.sender.Send(line)
+	return len(data), err
+}
+
+func (s *tagSender) Close() error {
+	return s.sender.Close()
+}
+
+// hostPort returns the host:port statsd is sent to over udp and tcp. An
+// IPv6 host may be given with or without brackets.
+func hostPort(statsd_config Statsd) string {
+	host := strings.TrimSuffix(strings.TrimPrefix(statsd_config.Host, "["), "]")
+	return net.JoinHostPort(host, strconv.Itoa(statsd_config.Port))
+}
+
+func newSender(statsd_config Statsd) (statsd.Sender, error) {
+	host_port := hostPort(statsd_config)
+
+	switch statsd_config.Transport {
+	case "", transportUDP:
+		return statsd.NewSimpleSender(host_port)
+	case transportTCP:
+		return statsd_config.streams.get("tcp", host_port), nil
+	case transportUnix:
+		return statsd_config.streams.get("unix", statsd_config.Socket), nil
+	case transportUnixgram:
+		conn, err := net.DialTimeout("unixgram", statsd_config.Socket, dialTimeout)
+		if err != nil {
+			return nil, err
+		}
+		return &datagramSender{conn: conn}, nil
+	}
+	return nil, fmt.Errorf("unknown statsd transport %q", statsd_config.Transport)
+}
@@ -0,0 +1,91 @@
+package mgostatsd
+
+import (
+	"bufio"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// tcpStatsd accepts connections and sends, for each one, a channel of
+// the lines read from it on conns. The channel is closed at EOF.
+type tcpStatsd struct {
+	listener net.Listener
+	conns    chan chan string
+}
+
+func (s *tcpStatsd) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		lines := make(chan string, 10)
+		s.conns <- lines
+		go func() {
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				lines <- scanner.Text()
+			}
+			close(lines)
+		}()
+	}
+}
+
+func TestStreamStoreKeepsConnection(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	server := &tcpStatsd{listener: listener, conns: make(chan chan string, 10)}
+	go server.serve()
+
+	config := DefaultConfig().withState(newState())
+	config.Statsd.Transport = transportTCP
+	config.Statsd.Host = "127.0.0.1"
+	config.Statsd.Port = listener.Addr().(*net.TCPAddr).Port
+	config.Statsd.Env = "env"
+	config.Statsd.Cluster = "cluster"
+
+	prefix := namingFor(config.Statsd.Naming).prefix(config.Statsd, "db1") + "."
+	push := func(stat string) {
+		client, err := newStatter(config.Statsd, "db1")
+		if err == nil {
+			err = client.Inc(stat, 1, 1.0)
+			closeStatter(client, &err)
+		}
+		if err != nil {
+			t.Fatalf("push %s: %s", stat, err)
+		}
+	}
+
+	push("first")
+	push("second")
+	lines := <-server.conns
+	got := []string{<-lines, <-lines}
+	want := []string{prefix + "first:1|c", prefix + "second:1|c"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("received %q, want %q", got, want)
+	}
+	if n := len(server.conns); n != 0 {
+		t.Errorf("%d more connections for two pushes, want none", n)
+	}
+
+	// A broken connection is redialed by the next push.
+	stream := config.Statsd.streams.m["tcp:"+hostPort(config.Statsd)]
+	stream.conn.Close()
+	push("third")
+	lines = <-server.conns
+	if line := <-lines; line != prefix+"third:1|c" {
+		t.Errorf("received %q after a redial, want %q", line, prefix+"third:1|c")
+	}
+
+	// Closing the store closes the connection.
+	config.state.streams.close()
+	for range lines {
+	}
+	if stream.conn != nil {
+		t.Errorf("connection still set after close")
+	}
+}
@@ -0,0 +1,74 @@
+package mgostatsd
+
+import (
+	"github.com/cactus/go-statsd-client/statsd"
+)
+
+type TTLMetrics struct {
+	DeletedDocuments int64 "deletedDocuments"
+	Passes           int64 "passes"
+}
+
+// ServerMetrics is the "metrics" section of serverStatus.
+type ServerMetrics struct {
+	TTL          TTLMetrics   "ttl"
+	GetLastError GetLastError "getLastError"
+}
+
+type FreeMonitoring struct {
+	State          string "state"
+	RegisterErrors int64  "registerErrors"
+	MetricsErrors  int64  "metricsErrors"
+}
+
+// pushTTL emits how many documents the TTL monitor removed, and how many
+// passes it made, since the previous poll. A TTL backlog shows as passes
+// that stall, or as deletions that fall behind the rate expiring
+// documents are inserted at while passes keep advancing.
+func pushTTL(client statsd.Statter, counters *counterStore, host string, ttl TTLMetrics) error {
+	var err error
+
+	deleted, ok := counters.delta(host+".ttl.deleted_documents", ttl.DeletedDocuments)
+	if ok {
+		err = client.Inc("ttl.deleted_documents", deleted, 1.0)
+		if err != nil {
+			return err
+		}
+	}
+
+	passes, ok := counters.delta(host+".ttl.passes", ttl.Passes)
+	if ok {
+		err = client.Inc("ttl.passes", passes, 1.0)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pushFreeMonitoring is a no-op on servers without free monitoring (before
+// 4.0, or when it was never configured).
+func pushFreeMonitoring(client statsd.Statter, monitoring FreeMonitoring) error {
+	var err error
+	if len(monitoring.State) == 0 {
+		return nil
+	}
+
+	err = client.Gauge("free_monitoring.state."+metricName(monitoring.State), 1, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("free_monitoring.register_errors", monitoring.RegisterErrors, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("free_monitoring.metrics_errors", monitoring.MetricsErrors, 1.0)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package mgostatsd
+
+import (
+	"github.com/cactus/go-statsd-client/statsd"
+)
+
+const (
+	unitMegabytes = "megabytes"
+	unitBytes     = "bytes"
+	unitNative    = "native"
+	unitMs        = "ms"
+)
+
+// Units converts metrics that serverStatus reports in mixed units. Memory
+// is megabytes, as reported, or bytes; Time is native (lock times in
+// microseconds, uptime in seconds) or ms. Converted metrics get the unit
+// appended to their name, as in mem.resident.bytes, so a dashboard can't
+// mistake one for the other.
+type Units struct {
+	Memory string "memory"
+	Time   string "time"
+}
+
+func (u Units) gaugeMemory(client statsd.Statter, name string, megabytes int64) error {
+	if u.Memory == unitBytes {
+		return client.Gauge(name+".bytes", megabytes*1024*1024, 1.0)
+	}
+	return client.Gauge(name, megabytes, 1.0)
+}
+
+func (u Units) gaugeMicros(client statsd.Statter, name string, micros int64) error {
+	if u.Time == unitMs {
+		return client.Gauge(name+".ms", micros/1000, 1.0)
+	}
+	return client.Gauge(name, micros, 1.0)
+}
+
+func (u Units) gaugeSeconds(client statsd.Statter, name string, seconds int64) error {
+	if u.Time == unitMs {
+		return client.Gauge(name+".ms", seconds*1000, 1.0)
+	}
+	return client.Gauge(name, seconds, 1.0)
+}
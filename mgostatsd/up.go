@@ -0,0 +1,32 @@
+package mgostatsd
+
+// pushUp sends whether the last poll of t succeeded as up (1 or 0), and
+// how many polls in a row have failed as consecutive_failures, so alerts
+// can fire on up == 0 for several intervals instead of on missing data.
+// A target that can't be reached has no server-reported host name, so
+// these are named after the target's label instead.
+func pushUp(config Config, t Target, status PollStatus) (err error) {
+	config = config.forTarget(t)
+	client, err := newStatter(config.Statsd, t.label())
+	if err != nil {
+		return err
+	}
+	defer closeStatter(client, &err)
+
+	var up int64
+	if len(status.Error) == 0 {
+		up = 1
+	}
+
+	err = client.Gauge("up", up, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("consecutive_failures", status.ConsecutiveFailures, 1.0)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
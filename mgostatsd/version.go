@@ -0,0 +1,56 @@
+package mgostatsd
+
+import (
+	"strconv"
+	"strings"
+)
+
+// serverVersion is the major.minor release a server reports in
+// serverStatus. Unparseable versions come out as 0.0.
+type serverVersion struct {
+	Major int
+	Minor int
+}
+
+func parseVersion(version string) serverVersion {
+	var v serverVersion
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return v
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return v
+	}
+	minor, err := strconv.Atoi(strings.TrimRightFunc(parts[1], func(r rune) bool {
+		return r < '0' || r > '9'
+	}))
+	if err != nil {
+		return v
+	}
+	return serverVersion{Major: major, Minor: minor}
+}
+
+func (v serverVersion) atLeast(major, minor int) bool {
+	return v.Major > major || (v.Major == major && v.Minor >= minor)
+}
+
+// layout records which version-dependent serverStatus fields a release
+// reports, so fields the server does not send are skipped instead of
+// coming through as zeros.
+type layout struct {
+	// globalLock.lockTime was removed in 3.0.
+	LockTime bool
+	// opLatencies was added in 3.2.
+	OpLatencies bool
+	// flowControl was added in 4.2.
+	FlowControl bool
+}
+
+func layoutFor(v serverVersion) layout {
+	return layout{
+		LockTime:    !v.atLeast(3, 0),
+		OpLatencies: v.atLeast(3, 2),
+		FlowControl: v.atLeast(4, 2),
+	}
+}
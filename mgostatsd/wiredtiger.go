@@ -0,0 +1,137 @@
+package mgostatsd
+
+import (
+	"github.com/cactus/go-statsd-client/statsd"
+)
+
+type WiredTigerCache struct {
+	BytesInCache int64 "bytes currently in the cache"
+	MaxBytes     int64 "maximum bytes configured"
+	DirtyBytes   int64 "tracked dirty bytes in the cache"
+}
+
+type WiredTigerTransaction struct {
+	Checkpoints       int64 "transaction checkpoints"
+	CheckpointRunning int64 "transaction checkpoint currently running"
+	CheckpointLastMs  int64 "transaction checkpoint most recent time (msecs)"
+	CheckpointMaxMs   int64 "transaction checkpoint max time (msecs)"
+	CheckpointMinMs   int64 "transaction checkpoint min time (msecs)"
+	CheckpointTotalMs int64 "transaction checkpoint total time (msecs)"
+}
+
+type Tickets struct {
+	Out          int64 "out"
+	Available    int64 "available"
+	TotalTickets int64 "totalTickets"
+}
+
+type ConcurrentTransactions struct {
+	Read  Tickets "read"
+	Write Tickets "write"
+}
+
+type WiredTiger struct {
+	Cache                  WiredTigerCache        "cache"
+	Transaction            WiredTigerTransaction  "transaction"
+	ConcurrentTransactions ConcurrentTransactions "concurrentTransactions"
+}
+
+// pushTickets emits the read or write execution tickets in use. Operations
+// queue once available reaches zero, so this is the saturation signal for
+// WiredTiger.
+func pushTickets(client statsd.Statter, name string, tickets Tickets) error {
+	var err error
+	prefix := "wired_tiger.tickets." + name + "."
+
+	err = client.Gauge(prefix+"out", tickets.Out, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge(prefix+"available", tickets.Available, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge(prefix+"total", tickets.TotalTickets, 1.0)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func pushWiredTiger(client statsd.Statter, wt WiredTiger) error {
+	var err error
+
+	err = client.Gauge("wired_tiger.cache.bytes", wt.Cache.BytesInCache, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("wired_tiger.cache.max_bytes", wt.Cache.MaxBytes, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("wired_tiger.cache.dirty_bytes", wt.Cache.DirtyBytes, 1.0)
+	if err != nil {
+		return err
+	}
+
+	// Eviction starts at 80% full or 5% dirty, and application threads are
+	// made to evict at 95% or 20%, which is when operations stall.
+	if wt.Cache.MaxBytes > 0 {
+		err = client.Gauge("wired_tiger.cache.fill_percent", wt.Cache.BytesInCache*100/wt.Cache.MaxBytes, 1.0)
+		if err != nil {
+			return err
+		}
+
+		err = client.Gauge("wired_tiger.cache.dirty_fill_percent", wt.Cache.DirtyBytes*100/wt.Cache.MaxBytes, 1.0)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = client.Gauge("wired_tiger.checkpoint.count", wt.Transaction.Checkpoints, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("wired_tiger.checkpoint.running", wt.Transaction.CheckpointRunning, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("wired_tiger.checkpoint.last_ms", wt.Transaction.CheckpointLastMs, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("wired_tiger.checkpoint.max_ms", wt.Transaction.CheckpointMaxMs, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("wired_tiger.checkpoint.min_ms", wt.Transaction.CheckpointMinMs, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = client.Gauge("wired_tiger.checkpoint.total_ms", wt.Transaction.CheckpointTotalMs, 1.0)
+	if err != nil {
+		return err
+	}
+
+	err = pushTickets(client, "read", wt.ConcurrentTransactions.Read)
+	if err != nil {
+		return err
+	}
+
+	err = pushTickets(client, "write", wt.ConcurrentTransactions.Write)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}